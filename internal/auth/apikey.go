@@ -0,0 +1,59 @@
+package auth
+
+import (
+	"slices"
+)
+
+// Scopes limit what an API key or access token may do. Every handler names
+// the one scope it needs.
+const (
+	ScopeChirpsRead  = "chirps:read"
+	ScopeChirpsWrite = "chirps:write"
+)
+
+// ScopeAccount covers everything else a user can do, like account settings,
+// following and managing API keys. Only the user's own logins get it, it can
+// not be given to API keys or OAuth clients.
+const ScopeAccount = "account"
+
+var scopes = []string{ScopeChirpsRead, ScopeChirpsWrite}
+
+// LoginScopes are the scopes of the access token of a login.
+var LoginScopes = []string{ScopeChirpsRead, ScopeChirpsWrite, ScopeAccount}
+
+// apiKeyPrefix marks chirpy keys so they are easy to spot in logs and secret
+// scanners, and apiKeyDisplayLength is how much of a key is kept in clear to
+// tell keys apart in listings.
+const (
+	apiKeyPrefix        = "chirpy_"
+	apiKeyDisplayLength = len(apiKeyPrefix) + 8
+)
+
+// ValidScope reports whether scope is one that can be given to API keys and
+// OAuth clients.
+func ValidScope(scope string) bool {
+	return slices.Contains(scopes, scope)
+}
+
+// HasScope reports whether granted includes scope.
+func HasScope(granted []string, scope string) bool {
+	return slices.Contains(granted, scope)
+}
+
+// MakeAPIKey returns a new random key. Only its HashToken digest is stored,
+// so it is shown to the user once.
+func MakeAPIKey() (string, error) {
+	token, err := MakeRefreshToken()
+	if err != nil {
+		return "", err
+	}
+	return apiKeyPrefix + token, nil
+}
+
+// APIKeyPrefix is the start of key that is safe to show again later.
+func APIKeyPrefix(key string) string {
+	if len(key) < apiKeyDisplayLength {
+		return key
+	}
+	return key[:apiKeyDisplayLength]
+}
@@ -0,0 +1,29 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMakeAPIKey(t *testing.T) {
+	key, err := MakeAPIKey()
+	if err != nil {
+		t.Fatalf("MakeAPIKey returned an error: %v", err)
+	}
+	if !strings.HasPrefix(key, "chirpy_") || (len(key) != len("chirpy_")+64) {
+		t.Errorf("Unexpected key format %v", key)
+	}
+	if prefix := APIKeyPrefix(key); prefix != key[:15] {
+		t.Errorf("Unexpected prefix %v", prefix)
+	}
+}
+
+func TestScopes(t *testing.T) {
+	if !ValidScope(ScopeChirpsRead) || !ValidScope(ScopeChirpsWrite) || ValidScope("chirps:delete") {
+		t.Error("Unexpected ValidScope result")
+	}
+	granted := []string{ScopeChirpsRead}
+	if !HasScope(granted, ScopeChirpsRead) || HasScope(granted, ScopeChirpsWrite) {
+		t.Error("Unexpected HasScope result")
+	}
+}
@@ -2,6 +2,8 @@ package auth
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/hex"
 	"errors"
 	"net/http"
@@ -10,59 +12,177 @@ import (
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
-	"golang.org/x/crypto/bcrypt"
 )
 
-func HashPassword(password string) (string, error) {
-	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	return string(hashed), err
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+// roleRanks orders the roles so a higher role passes every check a lower one
+// does: an admin can do everything a moderator can.
+var roleRanks = map[string]int{
+	RoleUser:      1,
+	RoleModerator: 2,
+	RoleAdmin:     3,
+}
+
+// ValidRole reports whether role is one of the known roles.
+func ValidRole(role string) bool {
+	_, ok := roleRanks[role]
+	return ok
 }
 
-func CheckPasswordHash(password, hash string) error {
-	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
-	return err
+// HasRole reports whether role grants at least the rights of required.
+// Unknown roles never pass.
+func HasRole(role, required string) bool {
+	rank, ok := roleRanks[role]
+	if !ok {
+		return false
+	}
+	return rank >= roleRanks[required]
 }
 
-func MakeJWT(userID uuid.UUID, tokenSecret string) (string, error) {
-	expiry := 3600 * time.Second
-	claims := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
-		Issuer:    "chirpy",
-		IssuedAt:  jwt.NewNumericDate(time.Now()),
-		ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiry)),
+// JWTConfig is how access tokens are issued and what ValidateJWTClaims
+// accepts.
+type JWTConfig struct {
+	Keys *KeySet
+	// Issuer goes in iss and is the only issuer accepted.
+	Issuer string
+	// Audience goes in aud and has to be named by every token, so tokens
+	// minted for another service sharing the keys are refused.
+	Audience string
+	// AccessTokenLifetime is how long the tokens of a login last, and
+	// ClientTokenLifetime the ones issued to OAuth clients.
+	AccessTokenLifetime time.Duration
+	ClientTokenLifetime time.Duration
+	// Leeway is how far the clocks of the servers may drift apart when exp,
+	// nbf and iat are checked.
+	Leeway time.Duration
+}
+
+var DefaultJWTConfig = JWTConfig{Issuer: "chirpy", Audience: "chirpy-api", AccessTokenLifetime: time.Hour, ClientTokenLifetime: time.Hour, Leeway: 30 * time.Second}
+
+// Claims are the JWT claims chirpy issues: the registered ones, the user's
+// role at the time the token was made and the space separated scopes the
+// token may be used for. Logins get LoginScopes. Tokens issued to an OAuth
+// client carry its client_id and the scopes the user granted it instead of a
+// role.
+type Claims struct {
+	jwt.RegisteredClaims
+	Role     string `json:"role,omitempty"`
+	Scope    string `json:"scope"`
+	ClientID string `json:"client_id,omitempty"`
+}
+
+// Scopes returns the scopes of the token.
+func (c *Claims) Scopes() []string {
+	return strings.Fields(c.Scope)
+}
+
+// IsClient reports whether the token was issued to an OAuth client rather
+// than to the user logging in themselves.
+func (c *Claims) IsClient() bool {
+	return c.ClientID != ""
+}
+
+// MakeJWT makes the access token of a login. It is signed with the key set's
+// current signing key, which is named in the kid header.
+func MakeJWT(userID uuid.UUID, role string, cfg *JWTConfig) (string, error) {
+	return signClaims(userID, Claims{Role: role, Scope: strings.Join(LoginScopes, " ")}, cfg.AccessTokenLifetime, cfg)
+}
+
+// MakeClientJWT makes an access token for an OAuth client acting for the user
+// with scopes.
+func MakeClientJWT(userID, clientID uuid.UUID, scopes []string, cfg *JWTConfig) (string, error) {
+	return signClaims(userID, Claims{Scope: strings.Join(scopes, " "), ClientID: clientID.String()}, cfg.ClientTokenLifetime, cfg)
+}
+
+func signClaims(userID uuid.UUID, claims Claims, lifetime time.Duration, cfg *JWTConfig) (string, error) {
+	key := cfg.Keys.signingKey()
+	now := time.Now()
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		Issuer:    cfg.Issuer,
 		Subject:   userID.String(),
-	})
-	ss, err := claims.SignedString([]byte(tokenSecret))
+		Audience:  jwt.ClaimStrings{cfg.Audience},
+		IssuedAt:  jwt.NewNumericDate(now),
+		NotBefore: jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(lifetime)),
+		ID:        uuid.NewString(),
+	}
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+	ss, err := token.SignedString(key.Private)
 	if err != nil {
 		return "", err
 	}
 	return ss, nil
 }
 
-func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
-	claims := &jwt.RegisteredClaims{}
-	parsedToken, err := jwt.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (interface{}, error) {
-		return []byte(tokenSecret), nil
-	})
+// ValidateJWT accepts only the user's own login tokens. Tokens issued to OAuth
+// clients are refused here; handlers that take them go through
+// ValidateJWTClaims and check the scope they need.
+func ValidateJWT(tokenString string, cfg *JWTConfig) (uuid.UUID, error) {
+	claims, err := ValidateJWTClaims(tokenString, cfg)
 	if err != nil {
 		return uuid.Nil, err
 	}
-	if !parsedToken.Valid {
-		return uuid.Nil, errors.New("token invalid")
+	if claims.IsClient() {
+		return uuid.Nil, errors.New("token was issued to an OAuth client")
 	}
-	userid, err := uuid.Parse(claims.Subject)
+	return uuid.Parse(claims.Subject)
+}
+
+// ValidateJWTClaims is ValidateJWT for callers that need more than the user id,
+// like the role or the scopes. Besides the signature it checks the algorithm
+// matches the key, the issuer and audience are cfg's, and exp, nbf and iat are
+// present and hold within cfg.Leeway. Client tokens come back as RoleUser.
+func ValidateJWTClaims(tokenString string, cfg *JWTConfig) (*Claims, error) {
+	claims := &Claims{}
+	parsedToken, err := jwt.ParseWithClaims(tokenString, claims, cfg.Keys.keyfunc,
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg()}),
+		jwt.WithIssuer(cfg.Issuer),
+		jwt.WithAudience(cfg.Audience),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(cfg.Leeway),
+	)
 	if err != nil {
-		return uuid.Nil, err
+		return nil, err
+	}
+	if !parsedToken.Valid {
+		return nil, errors.New("token invalid")
+	}
+	if _, err = uuid.Parse(claims.Subject); err != nil {
+		return nil, errors.New("token subject is not a user id")
+	}
+	if claims.ID == "" {
+		return nil, errors.New("token has no id")
+	}
+	if (claims.Role == "") || claims.IsClient() {
+		claims.Role = RoleUser
+	}
+	return claims, nil
+}
+
+// authorization returns the credentials of the Authorization header if it
+// uses scheme. Schemes are case-insensitive.
+func authorization(headers http.Header, scheme string) (string, bool) {
+	got, value, ok := strings.Cut(headers.Get("Authorization"), " ")
+	value = strings.TrimSpace(value)
+	if !ok || !strings.EqualFold(got, scheme) || (value == "") {
+		return "", false
 	}
-	return userid, nil
+	return value, true
 }
 
 func GetBearerToken(headers http.Header) (string, error) {
-	tokenraw := headers.Get("Authorization")
-	if tokenraw == "" {
+	token, ok := authorization(headers, "Bearer")
+	if !ok {
 		return "", errors.New("token doesnt exist")
 	}
-	tokenArr := strings.Split(tokenraw, " ")
-	return tokenArr[1], nil
+	return token, nil
 }
 
 func MakeRefreshToken() (string, error) {
@@ -75,11 +195,40 @@ func MakeRefreshToken() (string, error) {
 	return encodedStr, nil
 }
 
+// refreshTokenPrefixLength is how much of a refresh token is stored in the
+// clear to find its row. The rest of the token is only kept as a digest.
+const refreshTokenPrefixLength = 16
+
+// RefreshTokenPrefix is the lookup prefix stored next to the digest.
+func RefreshTokenPrefix(token string) string {
+	if len(token) < refreshTokenPrefixLength {
+		return token
+	}
+	return token[:refreshTokenPrefixLength]
+}
+
+// HashRefreshToken is the SHA-256 digest stored instead of the token. Refresh
+// tokens are 256 random bits, so a fast unsalted hash is enough.
+func HashRefreshToken(token string) []byte {
+	return HashToken(token)
+}
+
+// HashToken is the SHA-256 digest for any random token made with
+// MakeRefreshToken that is looked up by its digest, like login challenges.
+func HashToken(token string) []byte {
+	sum := sha256.Sum256([]byte(token))
+	return sum[:]
+}
+
+// CheckRefreshToken compares token against a stored digest in constant time.
+func CheckRefreshToken(token string, hash []byte) bool {
+	return subtle.ConstantTimeCompare(HashRefreshToken(token), hash) == 1
+}
+
 func GetAPIKey(headers http.Header) (string, error) {
-	keyraw := headers.Get("Authorization")
-	if keyraw == "" {
+	key, ok := authorization(headers, "ApiKey")
+	if !ok {
 		return "", errors.New("APIkey does not exist")
 	}
-	keyArr := strings.Split(keyraw, " ")
-	return keyArr[1], nil
+	return key, nil
 }
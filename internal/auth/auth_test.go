@@ -2,15 +2,17 @@ package auth
 
 import (
 	"net/http"
+	"slices"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
 )
 
 func TestMakeJWT(t *testing.T) {
 	userID := uuid.New()
-	secret := "chirpy"
-	tokenStr, err := MakeJWT(userID, secret)
+	cfg := newTestJWTConfig(newTestKeySet(t))
+	tokenStr, err := MakeJWT(userID, RoleUser, cfg)
 	if err != nil {
 		t.Fatalf("MakeJWT returned an error: %v", err)
 	}
@@ -22,14 +24,14 @@ func TestMakeJWT(t *testing.T) {
 
 func TestValidateJWT(t *testing.T) {
 	userID := uuid.New()
-	secret := "chirpy"
+	cfg := newTestJWTConfig(newTestKeySet(t))
 
 	// Testing accuracy
-	tokenStr, err := MakeJWT(userID, secret)
+	tokenStr, err := MakeJWT(userID, RoleUser, cfg)
 	if err != nil {
 		t.Fatalf("MakeJWT returned an error: %v", err)
 	}
-	jwtUserid, err := ValidateJWT(tokenStr, secret)
+	jwtUserid, err := ValidateJWT(tokenStr, cfg)
 	if err != nil {
 		t.Fatalf("ValidateJWT returned an error: %v", err)
 	}
@@ -37,15 +39,124 @@ func TestValidateJWT(t *testing.T) {
 		t.Errorf("Expected %v got %v", userID, jwtUserid)
 	}
 
-	// Testing Wrong Secret
-	diffSecret := "wrong"
-	diffTknStr, err := MakeJWT(userID, diffSecret)
+	// Testing Wrong Key
+	diffCfg := newTestJWTConfig(newTestKeySet(t))
+	diffTknStr, err := MakeJWT(userID, RoleUser, diffCfg)
 	if err != nil {
-		t.Fatalf("MakeJWT (different secret) returned an error: %v", err)
+		t.Fatalf("MakeJWT (different key) returned an error: %v", err)
 	}
-	_, err = ValidateJWT(diffTknStr, secret)
+	_, err = ValidateJWT(diffTknStr, cfg)
 	if err == nil {
-		t.Error("Expected wrong secret but got no error")
+		t.Error("Expected wrong key but got no error")
+	}
+}
+
+func TestValidateJWTClaimsRole(t *testing.T) {
+	userID := uuid.New()
+	cfg := newTestJWTConfig(newTestKeySet(t))
+
+	tokenStr, err := MakeJWT(userID, RoleModerator, cfg)
+	if err != nil {
+		t.Fatalf("MakeJWT returned an error: %v", err)
+	}
+	claims, err := ValidateJWTClaims(tokenStr, cfg)
+	if err != nil {
+		t.Fatalf("ValidateJWTClaims returned an error: %v", err)
+	}
+	if claims.Role != RoleModerator {
+		t.Errorf("Expected %v got %v", RoleModerator, claims.Role)
+	}
+
+	// Tokens without a role are plain users
+	tokenStr, err = MakeJWT(userID, "", cfg)
+	if err != nil {
+		t.Fatalf("MakeJWT returned an error: %v", err)
+	}
+	claims, err = ValidateJWTClaims(tokenStr, cfg)
+	if err != nil {
+		t.Fatalf("ValidateJWTClaims returned an error: %v", err)
+	}
+	if claims.Role != RoleUser {
+		t.Errorf("Expected %v got %v", RoleUser, claims.Role)
+	}
+}
+
+func TestValidateJWTClaimsStrict(t *testing.T) {
+	userID := uuid.New()
+	cfg := newTestJWTConfig(newTestKeySet(t))
+
+	tokenStr, err := MakeJWT(userID, RoleUser, cfg)
+	if err != nil {
+		t.Fatalf("MakeJWT returned an error: %v", err)
+	}
+	claims, err := ValidateJWTClaims(tokenStr, cfg)
+	if err != nil {
+		t.Fatalf("ValidateJWTClaims returned an error: %v", err)
+	}
+	if (claims.ID == "") || (claims.Issuer != cfg.Issuer) || !slices.Equal(claims.Audience, []string{cfg.Audience}) {
+		t.Errorf("Unexpected claims %+v", claims)
+	}
+	if !HasScope(claims.Scopes(), ScopeAccount) {
+		t.Errorf("Expected a login to have the %v scope, got %v", ScopeAccount, claims.Scopes())
+	}
+	again, err := MakeJWT(userID, RoleUser, cfg)
+	if err != nil {
+		t.Fatalf("MakeJWT returned an error: %v", err)
+	}
+	if againClaims, err := ValidateJWTClaims(again, cfg); (err != nil) || (againClaims.ID == claims.ID) {
+		t.Errorf("Expected every token to get its own jti, got %v", err)
+	}
+
+	// Tokens for another issuer or audience are refused
+	other := *cfg
+	other.Issuer = "someone-else"
+	if _, err = ValidateJWTClaims(tokenStr, &other); err == nil {
+		t.Error("Expected a token from another issuer to be rejected")
+	}
+	other = *cfg
+	other.Audience = "another-api"
+	if _, err = ValidateJWTClaims(tokenStr, &other); err == nil {
+		t.Error("Expected a token for another audience to be rejected")
+	}
+
+	// Expiry is checked with leeway for clock skew
+	other = *cfg
+	other.AccessTokenLifetime = -10 * time.Second
+	tokenStr, err = MakeJWT(userID, RoleUser, &other)
+	if err != nil {
+		t.Fatalf("MakeJWT returned an error: %v", err)
+	}
+	if _, err = ValidateJWTClaims(tokenStr, cfg); err != nil {
+		t.Errorf("Expected a token expired within the leeway to pass: %v", err)
+	}
+	other.AccessTokenLifetime = -time.Minute
+	tokenStr, err = MakeJWT(userID, RoleUser, &other)
+	if err != nil {
+		t.Fatalf("MakeJWT returned an error: %v", err)
+	}
+	if _, err = ValidateJWTClaims(tokenStr, cfg); err == nil {
+		t.Error("Expected a token expired past the leeway to be rejected")
+	}
+}
+
+func TestHasRole(t *testing.T) {
+	cases := []struct {
+		role     string
+		required string
+		want     bool
+	}{
+		{RoleUser, RoleUser, true},
+		{RoleUser, RoleModerator, false},
+		{RoleModerator, RoleModerator, true},
+		{RoleModerator, RoleAdmin, false},
+		{RoleAdmin, RoleModerator, true},
+		{RoleAdmin, RoleAdmin, true},
+		{"root", RoleUser, false},
+	}
+	for _, c := range cases {
+		if got := HasRole(c.role, c.required); got != c.want {
+			t.Errorf("HasRole(%q, %q) = %v, want %v", c.role, c.required, got, c.want)
+		}
 	}
 }
 
@@ -71,6 +182,27 @@ func TestMakeRefreshToken(t *testing.T) {
 	}
 }
 
+func TestCheckRefreshToken(t *testing.T) {
+	token, err := MakeRefreshToken()
+	if err != nil {
+		t.Fatalf("MakeRefreshToken returned an error: %v", err)
+	}
+	hash := HashRefreshToken(token)
+	if !CheckRefreshToken(token, hash) {
+		t.Error("Expected token to match its own digest")
+	}
+	other, err := MakeRefreshToken()
+	if err != nil {
+		t.Fatalf("MakeRefreshToken returned an error: %v", err)
+	}
+	if CheckRefreshToken(other, hash) {
+		t.Error("Expected a different token not to match")
+	}
+	if RefreshTokenPrefix(token) != token[:16] {
+		t.Errorf("Expected prefix %v got %v", token[:16], RefreshTokenPrefix(token))
+	}
+}
+
 func TestGetAPIKey(t *testing.T) {
 	headers := http.Header{
 		"Authorization": {"ApiKey THE_KEY_HERE"},
@@ -82,4 +214,11 @@ func TestGetAPIKey(t *testing.T) {
 		t.Errorf("Got error %v", err)
 	}
 
+	for _, value := range []string{"", "ApiKey", "ApiKey ", "Bearer THE_KEY_HERE"} {
+		headers.Set("Authorization", value)
+		if _, err = GetAPIKey(headers); err == nil {
+			t.Errorf("Expected %q to be rejected", value)
+		}
+	}
+
 }
@@ -0,0 +1,224 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// SigningKey is one asymmetric JWT key. Private is nil for keys that are only
+// kept around to verify tokens signed before a rotation.
+type SigningKey struct {
+	ID      string
+	Method  jwt.SigningMethod
+	Private crypto.Signer
+	Public  crypto.PublicKey
+}
+
+// JWK is the public half of a SigningKey as published in the JWKS document.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKSet is the body of /.well-known/jwks.json.
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// KeySet holds the key new tokens are signed with and every key tokens are
+// still accepted from. It does not change once built; to rotate, restart with
+// the new key as the signer and the old one as a verification key until the
+// tokens it signed have expired.
+type KeySet struct {
+	signing *SigningKey
+	keys    map[string]*SigningKey
+}
+
+func NewKeySet(signing *SigningKey, verify ...*SigningKey) (*KeySet, error) {
+	if (signing == nil) || (signing.Private == nil) {
+		return nil, errors.New("signing key needs a private key")
+	}
+	ks := &KeySet{keys: map[string]*SigningKey{}}
+	ks.signing = signing
+	ks.keys[signing.ID] = signing
+	for _, key := range verify {
+		ks.keys[key.ID] = key
+	}
+	return ks, nil
+}
+
+func (ks *KeySet) signingKey() *SigningKey {
+	return ks.signing
+}
+
+// keyfunc picks the verification key by the token's kid and refuses tokens
+// whose alg does not match that key, so a token can never choose how it is
+// verified.
+func (ks *KeySet) keyfunc(t *jwt.Token) (interface{}, error) {
+	kid, _ := t.Header["kid"].(string)
+	key, ok := ks.keys[kid]
+	if !ok {
+		return nil, errors.New("unknown signing key")
+	}
+	if t.Method.Alg() != key.Method.Alg() {
+		return nil, errors.New("unexpected signing method")
+	}
+	return key.Public, nil
+}
+
+// JWKS returns the public keys of every key in the set.
+func (ks *KeySet) JWKS() JWKSet {
+	set := JWKSet{Keys: []JWK{}}
+	for _, key := range ks.keys {
+		jwk, err := key.JWK()
+		if err != nil {
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
+
+// JWK encodes the public key. kid is filled in from key.ID.
+func (key *SigningKey) JWK() (JWK, error) {
+	jwk, err := publicJWK(key.Public)
+	if err != nil {
+		return JWK{}, err
+	}
+	jwk.Kid = key.ID
+	jwk.Use = "sig"
+	jwk.Alg = key.Method.Alg()
+	return jwk, nil
+}
+
+func publicJWK(public crypto.PublicKey) (JWK, error) {
+	switch pub := public.(type) {
+	case *rsa.PublicKey:
+		return JWK{
+			Kty: "RSA",
+			N:   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}, nil
+	case ed25519.PublicKey:
+		return JWK{Kty: "OKP", Crv: "Ed25519", X: base64.RawURLEncoding.EncodeToString(pub)}, nil
+	}
+	return JWK{}, fmt.Errorf("unsupported key type %T", public)
+}
+
+// thumbprint is the RFC 7638 JWK thumbprint, used as the kid so the same key
+// always gets the same id without having to configure one.
+func thumbprint(public crypto.PublicKey) (string, error) {
+	jwk, err := publicJWK(public)
+	if err != nil {
+		return "", err
+	}
+	// The required members in lexicographic order, which is what RFC 7638
+	// hashes. encoding/json writes map keys sorted.
+	members := map[string]string{"kty": jwk.Kty}
+	if jwk.Kty == "RSA" {
+		members["n"] = jwk.N
+		members["e"] = jwk.E
+	} else {
+		members["crv"] = jwk.Crv
+		members["x"] = jwk.X
+	}
+	raw, err := json.Marshal(members)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(raw)
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+func newSigningKey(private crypto.Signer, public crypto.PublicKey) (*SigningKey, error) {
+	key := &SigningKey{Private: private, Public: public}
+	switch public.(type) {
+	case *rsa.PublicKey:
+		key.Method = jwt.SigningMethodRS256
+	case ed25519.PublicKey:
+		key.Method = jwt.SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("unsupported key type %T, use RSA or Ed25519", public)
+	}
+	kid, err := thumbprint(public)
+	if err != nil {
+		return nil, err
+	}
+	key.ID = kid
+	return key, nil
+}
+
+// GenerateSigningKey makes a fresh Ed25519 key. It is meant for development;
+// tokens signed with it stop validating once the process exits.
+func GenerateSigningKey() (*SigningKey, error) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return newSigningKey(private, public)
+}
+
+// ParseKeyPEM reads a PEM encoded RSA or Ed25519 key. Private keys (PKCS#8 or
+// PKCS#1) can sign, public keys (PKIX) can only verify.
+func ParseKeyPEM(data []byte) (*SigningKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		signer, ok := parsed.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("unsupported key type %T", parsed)
+		}
+		return newSigningKey(signer, signer.Public())
+	case "RSA PRIVATE KEY":
+		parsed, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return newSigningKey(parsed, parsed.Public())
+	case "PUBLIC KEY":
+		parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return newSigningKey(nil, parsed)
+	}
+	return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+}
+
+func LoadKeyFile(path string) (*SigningKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := ParseKeyPEM(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return key, nil
+}
@@ -0,0 +1,173 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+func newTestKeySet(t *testing.T) *KeySet {
+	t.Helper()
+	key, err := GenerateSigningKey()
+	if err != nil {
+		t.Fatalf("GenerateSigningKey returned an error: %v", err)
+	}
+	keys, err := NewKeySet(key)
+	if err != nil {
+		t.Fatalf("NewKeySet returned an error: %v", err)
+	}
+	return keys
+}
+
+// newTestJWTConfig is DefaultJWTConfig with keys.
+func newTestJWTConfig(keys *KeySet) *JWTConfig {
+	cfg := DefaultJWTConfig
+	cfg.Keys = keys
+	return &cfg
+}
+
+func TestMakeJWTKid(t *testing.T) {
+	keys := newTestKeySet(t)
+	tokenStr, err := MakeJWT(uuid.New(), RoleUser, newTestJWTConfig(keys))
+	if err != nil {
+		t.Fatalf("MakeJWT returned an error: %v", err)
+	}
+	token, _, err := jwt.NewParser().ParseUnverified(tokenStr, &Claims{})
+	if err != nil {
+		t.Fatalf("ParseUnverified returned an error: %v", err)
+	}
+	if token.Header["kid"] != keys.signingKey().ID {
+		t.Errorf("Expected kid %v got %v", keys.signingKey().ID, token.Header["kid"])
+	}
+	if token.Method.Alg() != "EdDSA" {
+		t.Errorf("Expected EdDSA got %v", token.Method.Alg())
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	userID := uuid.New()
+	oldKeys := newTestKeySet(t)
+	oldKey := oldKeys.signingKey()
+	oldToken, err := MakeJWT(userID, RoleUser, newTestJWTConfig(oldKeys))
+	if err != nil {
+		t.Fatalf("MakeJWT returned an error: %v", err)
+	}
+
+	// A restart with a new signing key and the old one kept for verification
+	newKey, err := GenerateSigningKey()
+	if err != nil {
+		t.Fatalf("GenerateSigningKey returned an error: %v", err)
+	}
+	keys, err := NewKeySet(newKey, &SigningKey{ID: oldKey.ID, Method: oldKey.Method, Public: oldKey.Public})
+	if err != nil {
+		t.Fatalf("NewKeySet returned an error: %v", err)
+	}
+	newToken, err := MakeJWT(userID, RoleUser, newTestJWTConfig(keys))
+	if err != nil {
+		t.Fatalf("MakeJWT returned an error: %v", err)
+	}
+	if _, err = ValidateJWT(oldToken, newTestJWTConfig(keys)); err != nil {
+		t.Errorf("Old token rejected after rotation: %v", err)
+	}
+	if _, err = ValidateJWT(newToken, newTestJWTConfig(keys)); err != nil {
+		t.Errorf("New token rejected after rotation: %v", err)
+	}
+	if len(keys.JWKS().Keys) != 2 {
+		t.Errorf("Expected 2 keys in JWKS got %v", len(keys.JWKS().Keys))
+	}
+
+	// And a later restart without the old key
+	keys, err = NewKeySet(newKey)
+	if err != nil {
+		t.Fatalf("NewKeySet returned an error: %v", err)
+	}
+	if _, err = ValidateJWT(oldToken, newTestJWTConfig(keys)); err == nil {
+		t.Error("Expected the dropped key to be rejected but got no error")
+	}
+	if _, err = NewKeySet(&SigningKey{ID: oldKey.ID, Method: oldKey.Method, Public: oldKey.Public}); err == nil {
+		t.Error("Expected a signing key without a private key to be refused")
+	}
+}
+
+func TestValidateJWTRejectsHMAC(t *testing.T) {
+	keys := newTestKeySet(t)
+	// A token signed with HS256 using the public key bytes as the secret is
+	// the classic algorithm confusion attack.
+	jwk, err := keys.signingKey().JWK()
+	if err != nil {
+		t.Fatalf("JWK returned an error: %v", err)
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{RegisteredClaims: jwt.RegisteredClaims{
+		Issuer:    DefaultJWTConfig.Issuer,
+		Subject:   uuid.New().String(),
+		Audience:  jwt.ClaimStrings{DefaultJWTConfig.Audience},
+		IssuedAt:  jwt.NewNumericDate(time.Now()),
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		ID:        uuid.NewString(),
+	}})
+	token.Header["kid"] = jwk.Kid
+	tokenStr, err := token.SignedString([]byte(jwk.X))
+	if err != nil {
+		t.Fatalf("SignedString returned an error: %v", err)
+	}
+	if _, err = ValidateJWT(tokenStr, newTestJWTConfig(keys)); err == nil {
+		t.Error("Expected HS256 token to be rejected but got no error")
+	}
+}
+
+func TestParseKeyPEM(t *testing.T) {
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("rsa.GenerateKey returned an error: %v", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		t.Fatalf("MarshalPKCS8PrivateKey returned an error: %v", err)
+	}
+	key, err := ParseKeyPEM(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	if err != nil {
+		t.Fatalf("ParseKeyPEM returned an error: %v", err)
+	}
+	if key.Method.Alg() != "RS256" {
+		t.Errorf("Expected RS256 got %v", key.Method.Alg())
+	}
+
+	pubDer, err := x509.MarshalPKIXPublicKey(&private.PublicKey)
+	if err != nil {
+		t.Fatalf("MarshalPKIXPublicKey returned an error: %v", err)
+	}
+	pub, err := ParseKeyPEM(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDer}))
+	if err != nil {
+		t.Fatalf("ParseKeyPEM (public) returned an error: %v", err)
+	}
+	if pub.ID != key.ID {
+		t.Errorf("Expected the same kid for both halves, got %v and %v", key.ID, pub.ID)
+	}
+	if pub.Private != nil {
+		t.Error("Expected a verify only key")
+	}
+
+	// The public key alone verifies tokens signed with the private one
+	keys, err := NewKeySet(key)
+	if err != nil {
+		t.Fatalf("NewKeySet returned an error: %v", err)
+	}
+	tokenStr, err := MakeJWT(uuid.New(), RoleUser, newTestJWTConfig(keys))
+	if err != nil {
+		t.Fatalf("MakeJWT returned an error: %v", err)
+	}
+	other := newTestKeySet(t)
+	verifier, err := NewKeySet(other.signingKey(), pub)
+	if err != nil {
+		t.Fatalf("NewKeySet returned an error: %v", err)
+	}
+	if _, err = ValidateJWT(tokenStr, newTestJWTConfig(verifier)); err != nil {
+		t.Errorf("Expected token to verify with the public key: %v", err)
+	}
+}
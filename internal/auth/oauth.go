@@ -0,0 +1,93 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// PKCE code verifiers are 43 to 128 characters from the unreserved set
+// (RFC 7636 section 4.1).
+const (
+	minCodeVerifierLength = 43
+	maxCodeVerifierLength = 128
+)
+
+// PKCEChallenge is the S256 code challenge for verifier.
+func PKCEChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// VerifyPKCE checks verifier against an S256 challenge. The plain method is
+// not supported, it protects nothing once the challenge has been seen.
+func VerifyPKCE(verifier, challenge string) bool {
+	if (len(verifier) < minCodeVerifierLength) || (len(verifier) > maxCodeVerifierLength) {
+		return false
+	}
+	for _, c := range verifier {
+		if !isUnreserved(c) {
+			return false
+		}
+	}
+	return subtle.ConstantTimeCompare([]byte(PKCEChallenge(verifier)), []byte(challenge)) == 1
+}
+
+// ValidPKCEChallenge reports whether challenge can be an S256 challenge: the
+// base64url encoding of a SHA-256 digest.
+func ValidPKCEChallenge(challenge string) bool {
+	raw, err := base64.RawURLEncoding.DecodeString(challenge)
+	return (err == nil) && (len(raw) == sha256.Size)
+}
+
+func isUnreserved(c rune) bool {
+	return ((c >= 'a') && (c <= 'z')) || ((c >= 'A') && (c <= 'Z')) || ((c >= '0') && (c <= '9')) ||
+		(c == '-') || (c == '.') || (c == '_') || (c == '~')
+}
+
+// ValidateRedirectURI accepts absolute https URIs, and http ones on the
+// loopback interface for apps running on the user's machine. Fragments are
+// refused since the code is appended as a query parameter.
+func ValidateRedirectURI(raw string) error {
+	u, err := url.Parse(raw)
+	if (err != nil) || !u.IsAbs() || (u.Host == "") {
+		return fmt.Errorf("redirect uri %q is not an absolute URL", raw)
+	}
+	if u.Fragment != "" {
+		return fmt.Errorf("redirect uri %q can not have a fragment", raw)
+	}
+	if u.Scheme == "https" {
+		return nil
+	}
+	if u.Scheme == "http" {
+		host := u.Hostname()
+		if ip := net.ParseIP(host); (host == "localhost") || ((ip != nil) && ip.IsLoopback()) {
+			return nil
+		}
+	}
+	return fmt.Errorf("redirect uri %q must use https, or http on localhost", raw)
+}
+
+// ParseScope splits a space separated scope parameter and checks every scope
+// is known and among allowed. Duplicates are dropped.
+func ParseScope(scope string, allowed []string) ([]string, error) {
+	scopes := []string{}
+	for _, s := range strings.Fields(scope) {
+		if !ValidScope(s) || !slices.Contains(allowed, s) {
+			return nil, fmt.Errorf("scope %q is not allowed", s)
+		}
+		if !slices.Contains(scopes, s) {
+			scopes = append(scopes, s)
+		}
+	}
+	if len(scopes) == 0 {
+		return nil, errors.New("scope is required")
+	}
+	return scopes, nil
+}
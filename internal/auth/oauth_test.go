@@ -0,0 +1,87 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestPKCE(t *testing.T) {
+	// Example from RFC 7636 appendix B
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	challenge := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+	if got := PKCEChallenge(verifier); got != challenge {
+		t.Errorf("PKCEChallenge = %v, want %v", got, challenge)
+	}
+	if !ValidPKCEChallenge(challenge) {
+		t.Error("Expected the challenge to be valid")
+	}
+	if !VerifyPKCE(verifier, challenge) {
+		t.Error("Expected the verifier to match")
+	}
+	if VerifyPKCE(verifier[:42]+"x", challenge) {
+		t.Error("Expected a different verifier to be rejected")
+	}
+	if VerifyPKCE(challenge, challenge) {
+		t.Error("Expected the plain method to be rejected")
+	}
+	short := "abc"
+	if VerifyPKCE(short, PKCEChallenge(short)) {
+		t.Error("Expected a short verifier to be rejected")
+	}
+	if ValidPKCEChallenge("not-a-challenge") {
+		t.Error("Expected a malformed challenge to be rejected")
+	}
+}
+
+func TestValidateRedirectURI(t *testing.T) {
+	valid := []string{"https://partner.example.com/callback", "http://localhost:3000/cb", "http://127.0.0.1/cb", "http://[::1]:8000/cb"}
+	for _, uri := range valid {
+		if err := ValidateRedirectURI(uri); err != nil {
+			t.Errorf("Expected %v to be valid: %v", uri, err)
+		}
+	}
+	invalid := []string{"", "/callback", "http://partner.example.com/cb", "https://partner.example.com/cb#frag", "javascript:alert(1)"}
+	for _, uri := range invalid {
+		if err := ValidateRedirectURI(uri); err == nil {
+			t.Errorf("Expected %v to be rejected", uri)
+		}
+	}
+}
+
+func TestParseScope(t *testing.T) {
+	allowed := []string{ScopeChirpsRead}
+	scopes, err := ParseScope("chirps:read  chirps:read", allowed)
+	if (err != nil) || (strings.Join(scopes, " ") != "chirps:read") {
+		t.Errorf("Unexpected result %v, %v", scopes, err)
+	}
+	if _, err = ParseScope("chirps:write", allowed); err == nil {
+		t.Error("Expected a scope the client may not ask for to be rejected")
+	}
+	if _, err = ParseScope("", allowed); err == nil {
+		t.Error("Expected an empty scope to be rejected")
+	}
+}
+
+func TestClientJWT(t *testing.T) {
+	cfg := newTestJWTConfig(newTestKeySet(t))
+	userID, clientID := uuid.New(), uuid.New()
+	token, err := MakeClientJWT(userID, clientID, []string{ScopeChirpsRead, ScopeChirpsWrite}, cfg)
+	if err != nil {
+		t.Fatalf("MakeClientJWT returned an error: %v", err)
+	}
+	if _, err = ValidateJWT(token, cfg); err == nil {
+		t.Error("Expected ValidateJWT to refuse a client token")
+	}
+	claims, err := ValidateJWTClaims(token, cfg)
+	if err != nil {
+		t.Fatalf("ValidateJWTClaims returned an error: %v", err)
+	}
+	if !claims.IsClient() || (claims.ClientID != clientID.String()) || (claims.Role != RoleUser) {
+		t.Errorf("Unexpected claims %+v", claims)
+	}
+	if !HasScope(claims.Scopes(), ScopeChirpsWrite) {
+		t.Errorf("Expected scopes to round trip, got %v", claims.Scopes())
+	}
+}
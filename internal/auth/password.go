@@ -0,0 +1,209 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var ErrPasswordMismatch = errors.New("password does not match")
+
+// PasswordHasher is one password hashing scheme. Every scheme writes a
+// self-describing string, so stored hashes say how they were made and can be
+// checked after the defaults change.
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	// Verify returns ErrPasswordMismatch when password is wrong and other
+	// errors when encoded can not be read.
+	Verify(password, encoded string) error
+	// Owns reports whether encoded was written by this scheme.
+	Owns(encoded string) bool
+	// Outdated reports whether encoded was written with other parameters
+	// than the hasher uses now.
+	Outdated(encoded string) bool
+}
+
+// Argon2idHasher writes PHC strings like
+// $argon2id$v=19$m=19456,t=2,p=1$<salt>$<hash>. Memory is in KiB.
+type Argon2idHasher struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// DefaultArgon2id follows the OWASP minimum recommendation.
+var DefaultArgon2id = Argon2idHasher{Memory: 19 * 1024, Iterations: 2, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+type argon2idParams struct {
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+	salt        []byte
+	key         []byte
+}
+
+func (h Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.SaltLength)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return "", errors.New("could not generate random")
+	}
+	key := argon2.IDKey([]byte(password), salt, h.Iterations, h.Memory, h.Parallelism, h.KeyLength)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, h.Memory, h.Iterations, h.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func (h Argon2idHasher) Verify(password, encoded string) error {
+	p, err := parseArgon2id(encoded)
+	if err != nil {
+		return err
+	}
+	key := argon2.IDKey([]byte(password), p.salt, p.iterations, p.memory, p.parallelism, uint32(len(p.key)))
+	if subtle.ConstantTimeCompare(key, p.key) != 1 {
+		return ErrPasswordMismatch
+	}
+	return nil
+}
+
+func (h Argon2idHasher) Owns(encoded string) bool {
+	return strings.HasPrefix(encoded, "$argon2id$")
+}
+
+func (h Argon2idHasher) Outdated(encoded string) bool {
+	p, err := parseArgon2id(encoded)
+	if err != nil {
+		return true
+	}
+	return (p.memory != h.Memory) || (p.iterations != h.Iterations) || (p.parallelism != h.Parallelism) ||
+		(uint32(len(p.salt)) != h.SaltLength) || (uint32(len(p.key)) != h.KeyLength)
+}
+
+func parseArgon2id(encoded string) (argon2idParams, error) {
+	p := argon2idParams{}
+	parts := strings.Split(encoded, "$")
+	if (len(parts) != 6) || (parts[1] != "argon2id") {
+		return p, errors.New("not an argon2id hash")
+	}
+	var version int
+	_, err := fmt.Sscanf(parts[2], "v=%d", &version)
+	if err != nil {
+		return p, errors.New("malformed argon2id version")
+	}
+	if version != argon2.Version {
+		return p, fmt.Errorf("unsupported argon2id version %d", version)
+	}
+	_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.memory, &p.iterations, &p.parallelism)
+	if err != nil {
+		return p, errors.New("malformed argon2id parameters")
+	}
+	if (p.iterations == 0) || (p.parallelism == 0) {
+		return p, errors.New("malformed argon2id parameters")
+	}
+	p.salt, err = base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return p, errors.New("malformed argon2id salt")
+	}
+	p.key, err = base64.RawStdEncoding.DecodeString(parts[5])
+	if (err != nil) || (len(p.key) == 0) {
+		return p, errors.New("malformed argon2id hash")
+	}
+	return p, nil
+}
+
+// BcryptHasher is kept to check hashes written before argon2id. bcrypt only
+// looks at the first 72 bytes of a password.
+type BcryptHasher struct {
+	Cost int
+}
+
+func (h BcryptHasher) Hash(password string) (string, error) {
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), h.Cost)
+	return string(hashed), err
+}
+
+func (h BcryptHasher) Verify(password, encoded string) error {
+	err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return ErrPasswordMismatch
+	}
+	return err
+}
+
+func (h BcryptHasher) Owns(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2a$") || strings.HasPrefix(encoded, "$2b$") || strings.HasPrefix(encoded, "$2y$")
+}
+
+func (h BcryptHasher) Outdated(encoded string) bool {
+	cost, err := bcrypt.Cost([]byte(encoded))
+	return (err != nil) || (cost != h.Cost)
+}
+
+// Passwords hashes new passwords with the current scheme and still checks
+// hashes from every older one, so schemes can change without resetting
+// anyone's password.
+type Passwords struct {
+	current PasswordHasher
+	legacy  []PasswordHasher
+}
+
+func NewPasswords(current PasswordHasher, legacy ...PasswordHasher) *Passwords {
+	return &Passwords{current: current, legacy: legacy}
+}
+
+// DefaultPasswords hashes with argon2id and accepts the bcrypt hashes chirpy
+// used to write.
+var DefaultPasswords = NewPasswords(DefaultArgon2id, BcryptHasher{Cost: bcrypt.DefaultCost})
+
+func (p *Passwords) Hash(password string) (string, error) {
+	return p.current.Hash(password)
+}
+
+func (p *Passwords) hasher(encoded string) (PasswordHasher, error) {
+	if p.current.Owns(encoded) {
+		return p.current, nil
+	}
+	for _, h := range p.legacy {
+		if h.Owns(encoded) {
+			return h, nil
+		}
+	}
+	return nil, errors.New("unknown password hash scheme")
+}
+
+func (p *Passwords) Verify(password, encoded string) error {
+	h, err := p.hasher(encoded)
+	if err != nil {
+		return err
+	}
+	return h.Verify(password, encoded)
+}
+
+// NeedsRehash reports whether encoded should be replaced by a fresh hash
+// the next time the password is known, because it uses an older scheme or
+// older parameters.
+func (p *Passwords) NeedsRehash(encoded string) bool {
+	if !p.current.Owns(encoded) {
+		return true
+	}
+	return p.current.Outdated(encoded)
+}
+
+func HashPassword(password string) (string, error) {
+	return DefaultPasswords.Hash(password)
+}
+
+func CheckPasswordHash(password, hash string) error {
+	return DefaultPasswords.Verify(password, hash)
+}
+
+func PasswordNeedsRehash(hash string) bool {
+	return DefaultPasswords.NeedsRehash(hash)
+}
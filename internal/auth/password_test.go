@@ -0,0 +1,86 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestHashPassword(t *testing.T) {
+	hash, err := HashPassword("correct horse battery staple")
+	if err != nil {
+		t.Fatalf("HashPassword returned an error: %v", err)
+	}
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=19456,t=2,p=1$") {
+		t.Errorf("Unexpected hash format %v", hash)
+	}
+	if err = CheckPasswordHash("correct horse battery staple", hash); err != nil {
+		t.Errorf("Expected password to match: %v", err)
+	}
+	if err = CheckPasswordHash("Tr0ub4dor&3", hash); !errors.Is(err, ErrPasswordMismatch) {
+		t.Errorf("Expected ErrPasswordMismatch got %v", err)
+	}
+	if PasswordNeedsRehash(hash) {
+		t.Error("Expected a fresh hash to be current")
+	}
+}
+
+func TestLongPasswords(t *testing.T) {
+	// bcrypt would ignore everything past 72 bytes
+	long := strings.Repeat("a", 72)
+	hash, err := HashPassword(long + "b")
+	if err != nil {
+		t.Fatalf("HashPassword returned an error: %v", err)
+	}
+	if err = CheckPasswordHash(long+"c", hash); err == nil {
+		t.Error("Expected passwords differing after 72 bytes to be told apart")
+	}
+}
+
+func TestLegacyBcrypt(t *testing.T) {
+	legacy, err := bcrypt.GenerateFromPassword([]byte("123456"), bcrypt.DefaultCost)
+	if err != nil {
+		t.Fatalf("GenerateFromPassword returned an error: %v", err)
+	}
+	if err = CheckPasswordHash("123456", string(legacy)); err != nil {
+		t.Errorf("Expected bcrypt hash to still verify: %v", err)
+	}
+	if err = CheckPasswordHash("654321", string(legacy)); !errors.Is(err, ErrPasswordMismatch) {
+		t.Errorf("Expected ErrPasswordMismatch got %v", err)
+	}
+	if !PasswordNeedsRehash(string(legacy)) {
+		t.Error("Expected bcrypt hash to need a rehash")
+	}
+}
+
+func TestArgon2idOutdated(t *testing.T) {
+	weak := Argon2idHasher{Memory: 8 * 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+	hash, err := weak.Hash("123456")
+	if err != nil {
+		t.Fatalf("Hash returned an error: %v", err)
+	}
+	// Older parameters still verify but are flagged for an upgrade
+	if err = CheckPasswordHash("123456", hash); err != nil {
+		t.Errorf("Expected old parameters to verify: %v", err)
+	}
+	if !PasswordNeedsRehash(hash) {
+		t.Error("Expected old parameters to need a rehash")
+	}
+}
+
+func TestMalformedHashes(t *testing.T) {
+	for _, hash := range []string{
+		"",
+		"plaintext",
+		"$argon2id$v=19$m=19456,t=2,p=1$c2FsdA",
+		"$argon2id$v=16$m=19456,t=2,p=1$c2FsdHNhbHRzYWx0$aGFzaA",
+		"$argon2id$v=19$m=19456,t=0,p=1$c2FsdHNhbHRzYWx0$aGFzaA",
+		"$argon2id$v=19$m=19456,t=2,p=1$not base64!$aGFzaA",
+	} {
+		if err := CheckPasswordHash("123456", hash); (err == nil) || errors.Is(err, ErrPasswordMismatch) {
+			t.Errorf("Expected %q to be rejected as malformed got %v", hash, err)
+		}
+	}
+}
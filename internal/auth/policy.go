@@ -0,0 +1,177 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// The rules a password can break, as reported in PolicyViolation.Rule.
+const (
+	RuleMinLength        = "min_length"
+	RuleMaxLength        = "max_length"
+	RuleCharacterClasses = "character_classes"
+	RuleContainsEmail    = "contains_email"
+	RuleBreached         = "breached"
+)
+
+type PolicyViolation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// PasswordPolicy is what a new password has to satisfy. Lengths count
+// characters, not bytes.
+type PasswordPolicy struct {
+	MinLength int
+	MaxLength int
+	// MinClasses is how many of lowercase, uppercase, digits and symbols
+	// have to appear. Zero turns the rule off.
+	MinClasses int
+	// ForbidEmail refuses passwords containing the account's email or the
+	// part before the @.
+	ForbidEmail bool
+	// Breached is checked when set.
+	Breached *BreachList
+}
+
+var DefaultPasswordPolicy = PasswordPolicy{MinLength: 8, MaxLength: 128, ForbidEmail: true}
+
+// minEmailPartLength keeps short local parts like "jo" from ruling out every
+// password that happens to contain them.
+const minEmailPartLength = 3
+
+// Check returns every rule password breaks, or nil if it is fine. emails are
+// the addresses of the account it is for.
+func (p PasswordPolicy) Check(password string, emails ...string) []PolicyViolation {
+	var violations []PolicyViolation
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		violations = append(violations, PolicyViolation{Rule: RuleMinLength, Message: fmt.Sprintf("Password must be at least %d characters", p.MinLength)})
+	}
+	if (p.MaxLength > 0) && (length > p.MaxLength) {
+		violations = append(violations, PolicyViolation{Rule: RuleMaxLength, Message: fmt.Sprintf("Password must be at most %d characters", p.MaxLength)})
+	}
+	if (p.MinClasses > 0) && (characterClasses(password) < p.MinClasses) {
+		violations = append(violations, PolicyViolation{Rule: RuleCharacterClasses, Message: fmt.Sprintf("Password must mix at least %d of lowercase letters, uppercase letters, digits and symbols", p.MinClasses)})
+	}
+	if p.ForbidEmail && containsEmail(password, emails) {
+		violations = append(violations, PolicyViolation{Rule: RuleContainsEmail, Message: "Password must not contain your email"})
+	}
+	if (p.Breached != nil) && p.Breached.Contains(password) {
+		violations = append(violations, PolicyViolation{Rule: RuleBreached, Message: "Password has appeared in a data breach, choose another one"})
+	}
+	return violations
+}
+
+func characterClasses(password string) int {
+	var lower, upper, digit, symbol int
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = 1
+		case unicode.IsUpper(r):
+			upper = 1
+		case unicode.IsDigit(r):
+			digit = 1
+		default:
+			symbol = 1
+		}
+	}
+	return lower + upper + digit + symbol
+}
+
+func containsEmail(password string, emails []string) bool {
+	password = strings.ToLower(password)
+	for _, email := range emails {
+		email = strings.ToLower(strings.TrimSpace(email))
+		if email == "" {
+			continue
+		}
+		if strings.Contains(password, email) {
+			return true
+		}
+		local, _, _ := strings.Cut(email, "@")
+		if (len(local) >= minEmailPartLength) && strings.Contains(password, local) {
+			return true
+		}
+	}
+	return false
+}
+
+// BreachList holds SHA-1 digests of leaked passwords, grouped by their first
+// five hex digits the way the Pwned Passwords range API splits them.
+type BreachList struct {
+	ranges map[string]map[string]struct{}
+	size   int
+}
+
+// ParseBreachList reads one uppercase or lowercase SHA-1 hex digest per line,
+// optionally followed by :count as in the Pwned Passwords downloads. Blank
+// lines and lines starting with # are skipped.
+func ParseBreachList(r io.Reader) (*BreachList, error) {
+	list := &BreachList{ranges: map[string]map[string]struct{}{}}
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if (text == "") || strings.HasPrefix(text, "#") {
+			continue
+		}
+		digest, _, _ := strings.Cut(text, ":")
+		digest = strings.ToUpper(digest)
+		if _, err := hex.DecodeString(digest); (err != nil) || (len(digest) != 2*sha1.Size) {
+			return nil, fmt.Errorf("line %d: not a SHA-1 hex digest", line)
+		}
+		list.add(digest)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func LoadBreachList(path string) (*BreachList, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	list, err := ParseBreachList(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return list, nil
+}
+
+func (b *BreachList) add(digest string) {
+	prefix, suffix := digest[:5], digest[5:]
+	bucket, ok := b.ranges[prefix]
+	if !ok {
+		bucket = map[string]struct{}{}
+		b.ranges[prefix] = bucket
+	}
+	if _, ok = bucket[suffix]; !ok {
+		bucket[suffix] = struct{}{}
+		b.size++
+	}
+}
+
+// Len is the number of distinct digests in the list.
+func (b *BreachList) Len() int {
+	return b.size
+}
+
+func (b *BreachList) Contains(password string) bool {
+	sum := sha1.Sum([]byte(password))
+	digest := strings.ToUpper(hex.EncodeToString(sum[:]))
+	_, ok := b.ranges[digest[:5]][digest[5:]]
+	return ok
+}
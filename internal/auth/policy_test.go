@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+)
+
+func violatedRules(violations []PolicyViolation) []string {
+	rules := []string{}
+	for _, v := range violations {
+		rules = append(rules, v.Rule)
+	}
+	return rules
+}
+
+func TestPasswordPolicy(t *testing.T) {
+	policy := PasswordPolicy{MinLength: 8, MaxLength: 16, MinClasses: 3, ForbidEmail: true}
+	cases := map[string][]string{
+		"":                    {RuleMinLength, RuleCharacterClasses},
+		"Blue-Sky-42":         {},
+		"bluesky":             {RuleMinLength, RuleCharacterClasses},
+		"heisenberg":          {RuleCharacterClasses},
+		"Walt.White-1":        {RuleContainsEmail},
+		"Ünïcödé-Pässwörd-1":  {RuleMaxLength},
+		"ççççç-ÇÇ1":           {},
+		"aaaaaaaaaaaaaaaaaaa": {RuleMaxLength, RuleCharacterClasses},
+	}
+	for password, want := range cases {
+		got := violatedRules(policy.Check(password, "walt.white@breakingbad.com"))
+		if strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Errorf("Check(%q) = %v, want %v", password, got, want)
+		}
+	}
+}
+
+func TestPasswordPolicyShortEmail(t *testing.T) {
+	policy := PasswordPolicy{MinLength: 8, ForbidEmail: true}
+	if v := policy.Check("joyful-jog", "jo@example.com"); len(v) != 0 {
+		t.Errorf("Expected a two letter local part to be ignored got %v", v)
+	}
+	if v := policy.Check("x-JO@EXAMPLE.COM", "jo@example.com"); len(v) != 1 {
+		t.Errorf("Expected the full email to be refused got %v", v)
+	}
+}
+
+func TestBreachList(t *testing.T) {
+	// SHA-1 of "password" and "123456", the second with a count like the
+	// Pwned Passwords downloads
+	corpus := "# leaked\n5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8\n7c4a8d09ca3762af61e59520943dc26494f8941b:37359195\n\n"
+	list, err := ParseBreachList(strings.NewReader(corpus))
+	if err != nil {
+		t.Fatalf("ParseBreachList returned an error: %v", err)
+	}
+	if list.Len() != 2 {
+		t.Errorf("Expected 2 digests got %v", list.Len())
+	}
+	if !list.Contains("password") || !list.Contains("123456") {
+		t.Error("Expected listed passwords to be found")
+	}
+	if list.Contains("correct horse battery staple") {
+		t.Error("Expected unlisted password not to be found")
+	}
+
+	policy := PasswordPolicy{MinLength: 6, Breached: list}
+	if got := violatedRules(policy.Check("123456")); (len(got) != 1) || (got[0] != RuleBreached) {
+		t.Errorf("Expected only the breached rule got %v", got)
+	}
+
+	if _, err = ParseBreachList(strings.NewReader("not-a-digest\n")); err == nil {
+		t.Error("Expected a malformed line to be rejected")
+	}
+}
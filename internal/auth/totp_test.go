@@ -0,0 +1,96 @@
+package auth
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTOTPCodeRFC6238(t *testing.T) {
+	// Test vectors from RFC 6238 appendix B for SHA1, last six digits.
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+	cases := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+	for _, c := range cases {
+		got, err := TOTPCode(secret, time.Unix(c.unix, 0))
+		if err != nil {
+			t.Fatalf("TOTPCode returned an error: %v", err)
+		}
+		if got != c.want {
+			t.Errorf("TOTPCode at %v = %v, want %v", c.unix, got, c.want)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatalf("GenerateTOTPSecret returned an error: %v", err)
+	}
+	now := time.Now()
+	code, err := TOTPCode(secret, now)
+	if err != nil {
+		t.Fatalf("TOTPCode returned an error: %v", err)
+	}
+	counter, ok := ValidateTOTP(secret, code, now)
+	if !ok {
+		t.Fatal("Expected current code to validate")
+	}
+	if counter != now.Unix()/30 {
+		t.Errorf("Expected counter %v got %v", now.Unix()/30, counter)
+	}
+
+	// One step of drift is fine, two is not
+	if _, ok = ValidateTOTP(secret, code, now.Add(30*time.Second)); !ok {
+		t.Error("Expected code from the previous step to validate")
+	}
+	if _, ok = ValidateTOTP(secret, code, now.Add(90*time.Second)); ok {
+		t.Error("Expected code from three steps ago to be rejected")
+	}
+	if _, ok = ValidateTOTP(secret, "12345", now); ok {
+		t.Error("Expected short code to be rejected")
+	}
+}
+
+func TestTOTPURI(t *testing.T) {
+	uri := TOTPURI("JBSWY3DPEHPK3PXP", "Chirpy", "walt@example.com")
+	if !strings.HasPrefix(uri, "otpauth://totp/Chirpy:walt@example.com?") {
+		t.Errorf("Unexpected label in %v", uri)
+	}
+	if !strings.Contains(uri, "secret=JBSWY3DPEHPK3PXP") || !strings.Contains(uri, "issuer=Chirpy") {
+		t.Errorf("Missing parameters in %v", uri)
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes()
+	if err != nil {
+		t.Fatalf("GenerateRecoveryCodes returned an error: %v", err)
+	}
+	if len(codes) != 10 {
+		t.Fatalf("Expected 10 codes got %v", len(codes))
+	}
+	seen := map[string]bool{}
+	for _, code := range codes {
+		if len(code) != 11 || code[5] != '-' {
+			t.Errorf("Unexpected code format %v", code)
+		}
+		if seen[code] {
+			t.Errorf("Duplicate code %v", code)
+		}
+		seen[code] = true
+	}
+	loose := strings.ToUpper(strings.ReplaceAll(codes[0], "-", ""))
+	if string(HashRecoveryCode(loose)) != string(HashRecoveryCode(codes[0])) {
+		t.Error("Expected case and dash to be ignored")
+	}
+}
@@ -15,7 +15,7 @@ const changePassword = `-- name: ChangePassword :one
 UPDATE users
 SET hashed_password=$1
 WHERE id=$2
-RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, handle, role, email_verified_at
 `
 
 type ChangePasswordParams struct {
@@ -33,6 +33,29 @@ func (q *Queries) ChangePassword(ctx context.Context, arg ChangePasswordParams)
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.Handle,
+		&i.Role,
+		&i.EmailVerifiedAt,
 	)
 	return i, err
 }
+
+const rehashPassword = `-- name: RehashPassword :execrows
+UPDATE users
+SET hashed_password=$1
+WHERE (id=$2) AND (hashed_password=$3)
+`
+
+type RehashPasswordParams struct {
+	HashedPassword   string
+	ID               uuid.UUID
+	HashedPassword_2 string
+}
+
+func (q *Queries) RehashPassword(ctx context.Context, arg RehashPasswordParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, rehashPassword, arg.HashedPassword, arg.ID, arg.HashedPassword_2)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
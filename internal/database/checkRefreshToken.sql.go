@@ -7,22 +7,50 @@ package database
 
 import (
 	"context"
+
+	"github.com/lib/pq"
 )
 
-const queryRefreshToken = `-- name: QueryRefreshToken :one
-SELECT token, created_at, updated_at, user_id, expires_at, revoked_at FROM refresh_tokens WHERE (token=$1) AND (expires_at>NOW()) AND (revoked_at IS NULL)
+const queryRefreshToken = `-- name: QueryRefreshToken :many
+SELECT created_at, updated_at, user_id, expires_at, revoked_at, family_id, user_agent, ip, last_used_at, id, token_prefix, token_hash, client_id, scopes, rotated_at, grace_used_at FROM refresh_tokens WHERE (token_prefix=$1) AND (expires_at>NOW())
 `
 
-func (q *Queries) QueryRefreshToken(ctx context.Context, token string) (RefreshToken, error) {
-	row := q.db.QueryRowContext(ctx, queryRefreshToken, token)
-	var i RefreshToken
-	err := row.Scan(
-		&i.Token,
-		&i.CreatedAt,
-		&i.UpdatedAt,
-		&i.UserID,
-		&i.ExpiresAt,
-		&i.RevokedAt,
-	)
-	return i, err
+func (q *Queries) QueryRefreshToken(ctx context.Context, tokenPrefix string) ([]RefreshToken, error) {
+	rows, err := q.db.QueryContext(ctx, queryRefreshToken, tokenPrefix)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []RefreshToken
+	for rows.Next() {
+		var i RefreshToken
+		if err := rows.Scan(
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.UserID,
+			&i.ExpiresAt,
+			&i.RevokedAt,
+			&i.FamilyID,
+			&i.UserAgent,
+			&i.Ip,
+			&i.LastUsedAt,
+			&i.ID,
+			&i.TokenPrefix,
+			&i.TokenHash,
+			&i.ClientID,
+			pq.Array(&i.Scopes),
+			&i.RotatedAt,
+			&i.GraceUsedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
 }
@@ -9,36 +9,70 @@ import (
 	"context"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 const createRefreshToken = `-- name: CreateRefreshToken :one
-INSERT INTO refresh_tokens(token, created_at, updated_at, user_id, expires_at, revoked_at)
+INSERT INTO refresh_tokens(id, token_prefix, token_hash, created_at, updated_at, user_id, expires_at, revoked_at, family_id, user_agent, ip, last_used_at, client_id, scopes)
 VALUES (
+    gen_random_uuid(),
     $1,
+    $2,
     NOW(),
     NOW(),
-    $2,
+    $3,
     (NOW() + INTERVAL '60 days'),
-    NULL
+    NULL,
+    $4,
+    $5,
+    $6,
+    NOW(),
+    $7,
+    $8
 )
-RETURNING token, created_at, updated_at, user_id, expires_at, revoked_at
+RETURNING created_at, updated_at, user_id, expires_at, revoked_at, family_id, user_agent, ip, last_used_at, id, token_prefix, token_hash, client_id, scopes, rotated_at, grace_used_at
 `
 
 type CreateRefreshTokenParams struct {
-	Token  string
-	UserID uuid.UUID
+	TokenPrefix string
+	TokenHash   []byte
+	UserID      uuid.UUID
+	FamilyID    uuid.UUID
+	UserAgent   string
+	Ip          string
+	ClientID    uuid.NullUUID
+	Scopes      []string
 }
 
 func (q *Queries) CreateRefreshToken(ctx context.Context, arg CreateRefreshTokenParams) (RefreshToken, error) {
-	row := q.db.QueryRowContext(ctx, createRefreshToken, arg.Token, arg.UserID)
+	row := q.db.QueryRowContext(ctx, createRefreshToken,
+		arg.TokenPrefix,
+		arg.TokenHash,
+		arg.UserID,
+		arg.FamilyID,
+		arg.UserAgent,
+		arg.Ip,
+		arg.ClientID,
+		pq.Array(arg.Scopes),
+	)
 	var i RefreshToken
 	err := row.Scan(
-		&i.Token,
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.UserID,
 		&i.ExpiresAt,
 		&i.RevokedAt,
+		&i.FamilyID,
+		&i.UserAgent,
+		&i.Ip,
+		&i.LastUsedAt,
+		&i.ID,
+		&i.TokenPrefix,
+		&i.TokenHash,
+		&i.ClientID,
+		pq.Array(&i.Scopes),
+		&i.RotatedAt,
+		&i.GraceUsedAt,
 	)
 	return i, err
 }
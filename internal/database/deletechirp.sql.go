@@ -14,10 +14,20 @@ import (
 const deleteChirp = `-- name: DeleteChirp :exec
 DELETE FROM chirps
 WHERE id=$1
-RETURNING id, created_at, updated_at, body, user_id
+RETURNING id, created_at, updated_at, body, user_id, parent_id, kind, original_id, hidden_at
 `
 
 func (q *Queries) DeleteChirp(ctx context.Context, id uuid.UUID) error {
 	_, err := q.db.ExecContext(ctx, deleteChirp, id)
 	return err
 }
+
+const deleteRechirps = `-- name: DeleteRechirps :exec
+DELETE FROM chirps
+WHERE original_id=$1 AND kind='rechirp'
+`
+
+func (q *Queries) DeleteRechirps(ctx context.Context, originalID uuid.NullUUID) error {
+	_, err := q.db.ExecContext(ctx, deleteRechirps, originalID)
+	return err
+}
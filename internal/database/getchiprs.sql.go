@@ -7,15 +7,88 @@ package database
 
 import (
 	"context"
+	"database/sql"
+
+	"github.com/google/uuid"
 )
 
 const getChirps = `-- name: GetChirps :many
-Select id, created_at, updated_at, body, user_id from chirps
-ORDER BY created_at
+Select id, created_at, updated_at, body, user_id, parent_id, kind, original_id, hidden_at from chirps
+WHERE (($1::timestamp IS NULL)
+    OR ((created_at, id) > ($1::timestamp, $2::uuid)))
+    AND ((hidden_at IS NULL) OR (user_id=$3))
+ORDER BY created_at ASC, id ASC
+LIMIT $4
+`
+
+type GetChirpsParams struct {
+	CursorCreatedAt sql.NullTime
+	CursorID        uuid.NullUUID
+	ViewerID        uuid.NullUUID
+	PageSize        int32
+}
+
+func (q *Queries) GetChirps(ctx context.Context, arg GetChirpsParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirps,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.ViewerID,
+		arg.PageSize,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.ParentID,
+			&i.Kind,
+			&i.OriginalID,
+			&i.HiddenAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getChirpsDesc = `-- name: GetChirpsDesc :many
+Select id, created_at, updated_at, body, user_id, parent_id, kind, original_id, hidden_at from chirps
+WHERE (($1::timestamp IS NULL)
+    OR ((created_at, id) < ($1::timestamp, $2::uuid)))
+    AND ((hidden_at IS NULL) OR (user_id=$3))
+ORDER BY created_at DESC, id DESC
+LIMIT $4
 `
 
-func (q *Queries) GetChirps(ctx context.Context) ([]Chirp, error) {
-	rows, err := q.db.QueryContext(ctx, getChirps)
+type GetChirpsDescParams struct {
+	CursorCreatedAt sql.NullTime
+	CursorID        uuid.NullUUID
+	ViewerID        uuid.NullUUID
+	PageSize        int32
+}
+
+func (q *Queries) GetChirpsDesc(ctx context.Context, arg GetChirpsDescParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpsDesc,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.ViewerID,
+		arg.PageSize,
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -29,6 +102,10 @@ func (q *Queries) GetChirps(ctx context.Context) ([]Chirp, error) {
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.ParentID,
+			&i.Kind,
+			&i.OriginalID,
+			&i.HiddenAt,
 		); err != nil {
 			return nil, err
 		}
@@ -7,17 +7,94 @@ package database
 
 import (
 	"context"
+	"database/sql"
 
 	"github.com/google/uuid"
 )
 
 const getChirpsByAuthor = `-- name: GetChirpsByAuthor :many
-Select id, created_at, updated_at, body, user_id from chirps where user_id=$1
-ORDER BY created_at
+Select id, created_at, updated_at, body, user_id, parent_id, kind, original_id, hidden_at from chirps
+WHERE (user_id=$1)
+    AND (($2::timestamp IS NULL)
+    OR ((created_at, id) > ($2::timestamp, $3::uuid)))
+    AND ((hidden_at IS NULL) OR (user_id=$4))
+ORDER BY created_at ASC, id ASC
+LIMIT $5
 `
 
-func (q *Queries) GetChirpsByAuthor(ctx context.Context, userID uuid.UUID) ([]Chirp, error) {
-	rows, err := q.db.QueryContext(ctx, getChirpsByAuthor, userID)
+type GetChirpsByAuthorParams struct {
+	UserID          uuid.UUID
+	CursorCreatedAt sql.NullTime
+	CursorID        uuid.NullUUID
+	ViewerID        uuid.NullUUID
+	PageSize        int32
+}
+
+func (q *Queries) GetChirpsByAuthor(ctx context.Context, arg GetChirpsByAuthorParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpsByAuthor,
+		arg.UserID,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.ViewerID,
+		arg.PageSize,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.ParentID,
+			&i.Kind,
+			&i.OriginalID,
+			&i.HiddenAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getChirpsByAuthorDesc = `-- name: GetChirpsByAuthorDesc :many
+Select id, created_at, updated_at, body, user_id, parent_id, kind, original_id, hidden_at from chirps
+WHERE (user_id=$1)
+    AND (($2::timestamp IS NULL)
+    OR ((created_at, id) < ($2::timestamp, $3::uuid)))
+    AND ((hidden_at IS NULL) OR (user_id=$4))
+ORDER BY created_at DESC, id DESC
+LIMIT $5
+`
+
+type GetChirpsByAuthorDescParams struct {
+	UserID          uuid.UUID
+	CursorCreatedAt sql.NullTime
+	CursorID        uuid.NullUUID
+	ViewerID        uuid.NullUUID
+	PageSize        int32
+}
+
+func (q *Queries) GetChirpsByAuthorDesc(ctx context.Context, arg GetChirpsByAuthorDescParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpsByAuthorDesc,
+		arg.UserID,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.ViewerID,
+		arg.PageSize,
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -31,6 +108,10 @@ func (q *Queries) GetChirpsByAuthor(ctx context.Context, userID uuid.UUID) ([]Ch
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.ParentID,
+			&i.Kind,
+			&i.OriginalID,
+			&i.HiddenAt,
 		); err != nil {
 			return nil, err
 		}
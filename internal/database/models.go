@@ -11,28 +11,192 @@ import (
 	"github.com/google/uuid"
 )
 
+type ApiKey struct {
+	ID         uuid.UUID
+	UserID     uuid.UUID
+	Name       string
+	KeyPrefix  string
+	KeyHash    []byte
+	Scopes     []string
+	CreatedAt  time.Time
+	LastUsedAt sql.NullTime
+	RevokedAt  sql.NullTime
+}
+
+type BannedWord struct {
+	Word      string
+	CreatedAt time.Time
+}
+
+type BannedWordsSeeded struct {
+	ID       bool
+	SeededAt time.Time
+}
+
 type Chirp struct {
+	ID         uuid.UUID
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	Body       string
+	UserID     uuid.UUID
+	ParentID   uuid.NullUUID
+	Kind       string
+	OriginalID uuid.NullUUID
+	HiddenAt   sql.NullTime
+}
+
+type ChirpHashtag struct {
+	ChirpID   uuid.UUID
+	HashtagID uuid.UUID
+	CreatedAt time.Time
+}
+
+type ChirpLike struct {
+	UserID    uuid.UUID
+	ChirpID   uuid.UUID
+	CreatedAt time.Time
+}
+
+type ChirpMention struct {
+	ChirpID   uuid.UUID
+	UserID    uuid.UUID
+	CreatedAt time.Time
+}
+
+type ChirpReport struct {
+	ID         uuid.UUID
+	ChirpID    uuid.UUID
+	ReporterID uuid.UUID
+	Reason     string
+	CreatedAt  time.Time
+	ResolvedAt sql.NullTime
+	Resolution sql.NullString
+}
+
+type ChirpRevision struct {
+	ID         uuid.UUID
+	ChirpID    uuid.UUID
+	Body       string
+	CreatedAt  time.Time
+	ReplacedAt time.Time
+}
+
+type EmailVerificationToken struct {
 	ID        uuid.UUID
+	TokenHash []byte
+	UserID    uuid.UUID
+	Email     string
 	CreatedAt time.Time
-	UpdatedAt time.Time
-	Body      string
+	ExpiresAt time.Time
+	UsedAt    sql.NullTime
+}
+
+type Follow struct {
+	FollowerID uuid.UUID
+	FolloweeID uuid.UUID
+	CreatedAt  time.Time
+}
+
+type Hashtag struct {
+	ID        uuid.UUID
+	Tag       string
+	CreatedAt time.Time
+}
+
+type LoginChallenge struct {
+	ID        uuid.UUID
+	TokenHash []byte
 	UserID    uuid.UUID
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	Attempts  int32
+	UsedAt    sql.NullTime
 }
 
-type RefreshToken struct {
-	Token     string
+type OauthAuthorizationCode struct {
+	ID            uuid.UUID
+	CodeHash      []byte
+	ClientID      uuid.UUID
+	UserID        uuid.UUID
+	RedirectUri   string
+	Scopes        []string
+	CodeChallenge string
+	CreatedAt     time.Time
+	ExpiresAt     time.Time
+	UsedAt        sql.NullTime
+}
+
+type OauthClient struct {
+	ID           uuid.UUID
+	OwnerID      uuid.UUID
+	Name         string
+	SecretHash   []byte
+	RedirectUris []string
+	Scopes       []string
+	CreatedAt    time.Time
+	RevokedAt    sql.NullTime
+}
+
+type OauthConsent struct {
+	UserID    uuid.UUID
+	ClientID  uuid.UUID
+	Scopes    []string
 	CreatedAt time.Time
 	UpdatedAt time.Time
+}
+
+type PasswordResetToken struct {
+	ID        uuid.UUID
+	TokenHash []byte
 	UserID    uuid.UUID
+	CreatedAt time.Time
 	ExpiresAt time.Time
-	RevokedAt sql.NullTime
+	UsedAt    sql.NullTime
+}
+
+type RecoveryCode struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	CodeHash  []byte
+	CreatedAt time.Time
+	UsedAt    sql.NullTime
+}
+
+type RefreshToken struct {
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	UserID      uuid.UUID
+	ExpiresAt   time.Time
+	RevokedAt   sql.NullTime
+	FamilyID    uuid.UUID
+	UserAgent   string
+	Ip          string
+	LastUsedAt  time.Time
+	ID          uuid.UUID
+	TokenPrefix string
+	TokenHash   []byte
+	ClientID    uuid.NullUUID
+	Scopes      []string
+	RotatedAt   sql.NullTime
+	GraceUsedAt sql.NullTime
 }
 
 type User struct {
-	ID             uuid.UUID
-	CreatedAt      time.Time
-	UpdatedAt      time.Time
-	Email          string
-	HashedPassword string
-	IsChirpyRed    bool
+	ID              uuid.UUID
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+	Email           string
+	HashedPassword  string
+	IsChirpyRed     bool
+	Handle          sql.NullString
+	Role            string
+	EmailVerifiedAt sql.NullTime
+}
+
+type UserTotp struct {
+	UserID      uuid.UUID
+	Secret      string
+	CreatedAt   time.Time
+	EnabledAt   sql.NullTime
+	LastCounter int64
 }
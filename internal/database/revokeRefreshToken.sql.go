@@ -7,25 +7,38 @@ package database
 
 import (
 	"context"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 const revokeRefreshToken = `-- name: RevokeRefreshToken :one
 UPDATE refresh_tokens
 SET updated_at = NOW(), revoked_at = NOW()
-WHERE token=$1
-RETURNING token, created_at, updated_at, user_id, expires_at, revoked_at
+WHERE id=$1
+RETURNING created_at, updated_at, user_id, expires_at, revoked_at, family_id, user_agent, ip, last_used_at, id, token_prefix, token_hash, client_id, scopes, rotated_at, grace_used_at
 `
 
-func (q *Queries) RevokeRefreshToken(ctx context.Context, token string) (RefreshToken, error) {
-	row := q.db.QueryRowContext(ctx, revokeRefreshToken, token)
+func (q *Queries) RevokeRefreshToken(ctx context.Context, id uuid.UUID) (RefreshToken, error) {
+	row := q.db.QueryRowContext(ctx, revokeRefreshToken, id)
 	var i RefreshToken
 	err := row.Scan(
-		&i.Token,
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.UserID,
 		&i.ExpiresAt,
 		&i.RevokedAt,
+		&i.FamilyID,
+		&i.UserAgent,
+		&i.Ip,
+		&i.LastUsedAt,
+		&i.ID,
+		&i.TokenPrefix,
+		&i.TokenHash,
+		&i.ClientID,
+		pq.Array(&i.Scopes),
+		&i.RotatedAt,
+		&i.GraceUsedAt,
 	)
 	return i, err
 }
@@ -15,7 +15,7 @@ const upgradeUser = `-- name: UpgradeUser :one
 UPDATE users
 SET is_chirpy_red=true
 WHERE id=$1
-RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, handle, role, email_verified_at
 `
 
 func (q *Queries) UpgradeUser(ctx context.Context, id uuid.UUID) (User, error) {
@@ -28,6 +28,9 @@ func (q *Queries) UpgradeUser(ctx context.Context, id uuid.UUID) (User, error) {
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.Handle,
+		&i.Role,
+		&i.EmailVerifiedAt,
 	)
 	return i, err
 }
@@ -10,7 +10,7 @@ import (
 )
 
 const userByEmail = `-- name: UserByEmail :one
-Select id, created_at, updated_at, email, hashed_password, is_chirpy_red from users WHERE email=$1
+Select id, created_at, updated_at, email, hashed_password, is_chirpy_red, handle, role, email_verified_at from users WHERE email=$1
 `
 
 func (q *Queries) UserByEmail(ctx context.Context, email string) (User, error) {
@@ -23,6 +23,9 @@ func (q *Queries) UserByEmail(ctx context.Context, email string) (User, error) {
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.Handle,
+		&i.Role,
+		&i.EmailVerifiedAt,
 	)
 	return i, err
 }
@@ -0,0 +1,168 @@
+// Package mail sends the transactional emails chirpy needs, like password
+// resets. Handlers only see the Mailer interface so local runs can write mail
+// to the log or to files instead of a real SMTP server.
+package mail
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	netmail "net/mail"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// format renders msg as a plain text RFC 5322 message.
+func format(from string, msg Message, now time.Time) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", msg.Subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
+
+// checkHeaders refuses line breaks in header values, which would let a caller
+// inject extra headers or recipients.
+func checkHeaders(values ...string) error {
+	for _, v := range values {
+		if strings.ContainsAny(v, "\r\n") {
+			return errors.New("mail header contains a line break")
+		}
+	}
+	return nil
+}
+
+// SMTPMailer sends through an SMTP server, with PLAIN auth when Username is
+// set. net/smtp upgrades to STARTTLS whenever the server offers it.
+type SMTPMailer struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	if err := checkHeaders(m.From, msg.To, msg.Subject); err != nil {
+		return err
+	}
+	// From may carry a display name, which belongs in the header but not in
+	// the envelope's MAIL FROM.
+	from, err := netmail.ParseAddress(m.From)
+	if err != nil {
+		return fmt.Errorf("invalid MAIL_FROM %q: %w", m.From, err)
+	}
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- smtp.SendMail(net.JoinHostPort(m.Host, m.Port), auth, from.Address, []string{msg.To}, format(m.From, msg, time.Now()))
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// LogMailer writes every message to a logger. Nothing leaves the machine.
+type LogMailer struct {
+	Logger *log.Logger
+	From   string
+}
+
+func (m *LogMailer) Send(ctx context.Context, msg Message) error {
+	if err := checkHeaders(m.From, msg.To, msg.Subject); err != nil {
+		return err
+	}
+	logger := m.Logger
+	if logger == nil {
+		logger = log.Default()
+	}
+	logger.Printf("mail to %s: %s\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+// FileMailer writes every message as an .eml file into Dir, which most mail
+// clients can open.
+type FileMailer struct {
+	Dir  string
+	From string
+	seq  atomic.Int64
+}
+
+func (m *FileMailer) Send(ctx context.Context, msg Message) error {
+	if err := checkHeaders(m.From, msg.To, msg.Subject); err != nil {
+		return err
+	}
+	err := os.MkdirAll(m.Dir, 0o700)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	name := fmt.Sprintf("%s-%d.eml", now.Format("20060102T150405.000000000"), m.seq.Add(1))
+	return os.WriteFile(filepath.Join(m.Dir, name), format(m.From, msg, now), 0o600)
+}
+
+// NewFromEnv picks the mailer from MAIL_DRIVER: "smtp", "file" or "log". The
+// log and file drivers keep reset and verification tokens in plain text, so an
+// unset MAIL_DRIVER only falls back to "log" when PLATFORM is "dev". getenv is
+// os.Getenv outside of tests.
+func NewFromEnv(getenv func(string) string) (Mailer, error) {
+	from := getenv("MAIL_FROM")
+	if from == "" {
+		from = "Chirpy <no-reply@localhost>"
+	}
+	if _, err := netmail.ParseAddress(from); err != nil {
+		return nil, fmt.Errorf("invalid MAIL_FROM %q: %w", from, err)
+	}
+	switch getenv("MAIL_DRIVER") {
+	case "":
+		if getenv("PLATFORM") != "dev" {
+			return nil, errors.New("MAIL_DRIVER is required, use smtp, file or log")
+		}
+		return &LogMailer{From: from}, nil
+	case "log":
+		return &LogMailer{From: from}, nil
+	case "file":
+		dir := getenv("MAIL_DIR")
+		if dir == "" {
+			dir = "mail"
+		}
+		return &FileMailer{Dir: dir, From: from}, nil
+	case "smtp":
+		m := &SMTPMailer{Host: getenv("SMTP_HOST"), Port: getenv("SMTP_PORT"), Username: getenv("SMTP_USERNAME"), Password: getenv("SMTP_PASSWORD"), From: from}
+		if m.Host == "" {
+			return nil, errors.New("SMTP_HOST is required for the smtp mail driver")
+		}
+		if m.Port == "" {
+			m.Port = "587"
+		}
+		return m, nil
+	}
+	return nil, fmt.Errorf("unknown MAIL_DRIVER %q, use smtp, file or log", getenv("MAIL_DRIVER"))
+}
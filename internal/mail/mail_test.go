@@ -0,0 +1,175 @@
+package mail
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileMailer(t *testing.T) {
+	dir := t.TempDir()
+	mailer := &FileMailer{Dir: dir, From: "Chirpy <no-reply@localhost>"}
+	err := mailer.Send(context.Background(), Message{To: "walt@breakingbad.com", Subject: "Reset", Body: "line one\nline two"})
+	if err != nil {
+		t.Fatalf("Send returned an error: %v", err)
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("Expected one .eml file got %v (%v)", files, err)
+	}
+	raw, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatalf("ReadFile returned an error: %v", err)
+	}
+	content := string(raw)
+	for _, want := range []string{"To: walt@breakingbad.com\r\n", "Subject: Reset\r\n", "\r\n\r\nline one\r\nline two"} {
+		if !strings.Contains(content, want) {
+			t.Errorf("Expected %q in %q", want, content)
+		}
+	}
+}
+
+func TestLogMailer(t *testing.T) {
+	var buf bytes.Buffer
+	mailer := &LogMailer{Logger: log.New(&buf, "", 0)}
+	err := mailer.Send(context.Background(), Message{To: "walt@breakingbad.com", Subject: "Reset", Body: "token"})
+	if err != nil {
+		t.Fatalf("Send returned an error: %v", err)
+	}
+	if !strings.Contains(buf.String(), "walt@breakingbad.com") || !strings.Contains(buf.String(), "token") {
+		t.Errorf("Unexpected log output %q", buf.String())
+	}
+}
+
+// fakeSMTP accepts one message on a local port and reports the MAIL FROM
+// command and the message data it was given.
+func fakeSMTP(t *testing.T) (host, port string, result <-chan [2]string) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen returned an error: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	done := make(chan [2]string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+		reply("220 localhost ESMTP")
+		var mailFrom string
+		var data strings.Builder
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimRight(line, "\r\n")
+			cmd := strings.ToUpper(line)
+			switch {
+			case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+				reply("250 localhost")
+			case strings.HasPrefix(cmd, "MAIL FROM:"):
+				mailFrom = line
+				reply("250 OK")
+			case strings.HasPrefix(cmd, "RCPT TO:"):
+				reply("250 OK")
+			case cmd == "DATA":
+				reply("354 go ahead")
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if line == ".\r\n" {
+						break
+					}
+					data.WriteString(line)
+				}
+				reply("250 OK")
+			case cmd == "QUIT":
+				reply("221 bye")
+				done <- [2]string{mailFrom, data.String()}
+				return
+			default:
+				reply("502 not implemented")
+			}
+		}
+	}()
+	host, port, _ = net.SplitHostPort(ln.Addr().String())
+	return host, port, done
+}
+
+func TestSMTPMailerEnvelopeFrom(t *testing.T) {
+	host, port, result := fakeSMTP(t)
+	mailer := &SMTPMailer{Host: host, Port: port, From: "Chirpy <no-reply@example.com>"}
+	err := mailer.Send(context.Background(), Message{To: "walt@breakingbad.com", Subject: "Reset", Body: "token"})
+	if err != nil {
+		t.Fatalf("Send returned an error: %v", err)
+	}
+	got := <-result
+	if got[0] != "MAIL FROM:<no-reply@example.com>" && !strings.HasPrefix(got[0], "MAIL FROM:<no-reply@example.com> ") {
+		t.Errorf("Expected the bare address in MAIL FROM got %q", got[0])
+	}
+	if !strings.Contains(got[1], "From: Chirpy <no-reply@example.com>\r\n") {
+		t.Errorf("Expected the display name in the From header got %q", got[1])
+	}
+}
+
+func TestSMTPMailerInvalidFrom(t *testing.T) {
+	mailer := &SMTPMailer{Host: "127.0.0.1", Port: "1", From: "not an address"}
+	if err := mailer.Send(context.Background(), Message{To: "walt@breakingbad.com", Subject: "Reset"}); err == nil {
+		t.Error("Expected an invalid From to be rejected")
+	}
+}
+
+func TestHeaderInjection(t *testing.T) {
+	mailer := &LogMailer{Logger: log.New(&bytes.Buffer{}, "", 0)}
+	err := mailer.Send(context.Background(), Message{To: "walt@breakingbad.com\r\nBcc: jesse@breakingbad.com", Subject: "Reset"})
+	if err == nil {
+		t.Error("Expected line break in header to be rejected")
+	}
+}
+
+func TestNewFromEnv(t *testing.T) {
+	env := func(values map[string]string) func(string) string {
+		return func(key string) string { return values[key] }
+	}
+	if _, err := NewFromEnv(env(nil)); err == nil {
+		t.Error("Expected a missing MAIL_DRIVER to fail outside dev")
+	}
+	if m, err := NewFromEnv(env(map[string]string{"PLATFORM": "dev"})); err != nil {
+		t.Errorf("Default dev driver returned an error: %v", err)
+	} else if _, ok := m.(*LogMailer); !ok {
+		t.Errorf("Expected LogMailer got %T", m)
+	}
+	if m, err := NewFromEnv(env(map[string]string{"MAIL_DRIVER": "log"})); err != nil {
+		t.Errorf("Explicit log driver returned an error: %v", err)
+	} else if _, ok := m.(*LogMailer); !ok {
+		t.Errorf("Expected LogMailer got %T", m)
+	}
+	if _, err := NewFromEnv(env(map[string]string{"MAIL_DRIVER": "smtp"})); err == nil {
+		t.Error("Expected smtp without SMTP_HOST to fail")
+	}
+	m, err := NewFromEnv(env(map[string]string{"MAIL_DRIVER": "smtp", "SMTP_HOST": "mail.example.com"}))
+	if err != nil {
+		t.Fatalf("smtp driver returned an error: %v", err)
+	}
+	if m.(*SMTPMailer).Port != "587" {
+		t.Errorf("Expected default port 587 got %v", m.(*SMTPMailer).Port)
+	}
+	if _, err := NewFromEnv(env(map[string]string{"MAIL_DRIVER": "smtp", "SMTP_HOST": "mail.example.com", "MAIL_FROM": "Chirpy"})); err == nil {
+		t.Error("Expected an invalid MAIL_FROM to fail")
+	}
+	if _, err := NewFromEnv(env(map[string]string{"MAIL_DRIVER": "pigeon"})); err == nil {
+		t.Error("Expected unknown driver to fail")
+	}
+}
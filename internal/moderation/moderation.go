@@ -0,0 +1,189 @@
+package moderation
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Strategy decides what a banned word is replaced with.
+type Strategy string
+
+const (
+	// StrategyFixed replaces every banned word with "****".
+	StrategyFixed Strategy = "fixed"
+	// StrategyMask replaces every rune of a banned word with "*".
+	StrategyMask Strategy = "mask"
+	// StrategyFirstLetter keeps the first rune and masks the rest.
+	StrategyFirstLetter Strategy = "first_letter"
+)
+
+// DefaultWords is used when no word list is configured anywhere else.
+var DefaultWords = []string{"kerfuffle", "sharbert", "fornax"}
+
+// Filter censors banned words in text. It is safe for concurrent use, so the
+// word list can be changed while requests are being filtered.
+type Filter struct {
+	mu       sync.RWMutex
+	words    map[string]struct{}
+	strategy Strategy
+}
+
+func NewFilter(words []string, strategy Strategy) *Filter {
+	f := &Filter{words: map[string]struct{}{}, strategy: strategy}
+	for _, w := range words {
+		f.Add(w)
+	}
+	return f
+}
+
+func ParseStrategy(s string) (Strategy, error) {
+	switch Strategy(s) {
+	case "":
+		return StrategyFixed, nil
+	case StrategyFixed, StrategyMask, StrategyFirstLetter:
+		return Strategy(s), nil
+	}
+	return "", errors.New("unknown replacement strategy")
+}
+
+// NormalizeWord returns the form words are stored and compared in, or "" if
+// word is not a single token the filter could ever match.
+func NormalizeWord(word string) string {
+	word = strings.ToLower(strings.TrimSpace(word))
+	if (word == "") || (strings.IndexFunc(word, func(c rune) bool { return !isWordRune(c) }) >= 0) {
+		return ""
+	}
+	return word
+}
+
+// LoadWordList reads one word per line. Blank lines and lines starting with #
+// are skipped.
+func LoadWordList(r io.Reader) ([]string, error) {
+	var words []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if (line == "") || strings.HasPrefix(line, "#") {
+			continue
+		}
+		word := NormalizeWord(line)
+		if word == "" {
+			return nil, errors.New("invalid word in list: " + line)
+		}
+		words = append(words, word)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return words, nil
+}
+
+func LoadWordFile(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return LoadWordList(file)
+}
+
+// Add bans word and reports whether it was a valid word.
+func (f *Filter) Add(word string) bool {
+	word = NormalizeWord(word)
+	if word == "" {
+		return false
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.words[word] = struct{}{}
+	return true
+}
+
+func (f *Filter) Remove(word string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.words, NormalizeWord(word))
+}
+
+// Replace swaps the whole word list at once, for reloading it from where it
+// is stored. Invalid words are skipped.
+func (f *Filter) Replace(words []string) {
+	replaced := map[string]struct{}{}
+	for _, w := range words {
+		if w = NormalizeWord(w); w != "" {
+			replaced[w] = struct{}{}
+		}
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.words = replaced
+}
+
+// Words returns the banned words in alphabetical order.
+func (f *Filter) Words() []string {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	words := make([]string, 0, len(f.words))
+	for w := range f.words {
+		words = append(words, w)
+	}
+	sort.Strings(words)
+	return words
+}
+
+// Clean replaces banned words in text. Words are runs of letters, digits and
+// combining marks, so punctuation around a word ("Kerfuffle!") does not hide
+// it and everything that is not a banned word is kept byte for byte.
+func (f *Filter) Clean(text string) string {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	var b strings.Builder
+	b.Grow(len(text))
+	start := -1
+	flush := func(end int) {
+		if start < 0 {
+			return
+		}
+		word := text[start:end]
+		if _, banned := f.words[strings.ToLower(word)]; banned {
+			b.WriteString(f.replacement(word))
+		} else {
+			b.WriteString(word)
+		}
+		start = -1
+	}
+	for i, c := range text {
+		if isWordRune(c) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		flush(i)
+		b.WriteRune(c)
+	}
+	flush(len(text))
+	return b.String()
+}
+
+func (f *Filter) replacement(word string) string {
+	switch f.strategy {
+	case StrategyMask:
+		return strings.Repeat("*", utf8.RuneCountInString(word))
+	case StrategyFirstLetter:
+		first, size := utf8.DecodeRuneInString(word)
+		return string(first) + strings.Repeat("*", utf8.RuneCountInString(word[size:]))
+	}
+	return "****"
+}
+
+func isWordRune(c rune) bool {
+	return unicode.IsLetter(c) || unicode.IsDigit(c) || unicode.IsMark(c)
+}
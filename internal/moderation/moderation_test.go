@@ -0,0 +1,93 @@
+package moderation
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestClean(t *testing.T) {
+	filter := NewFilter(DefaultWords, StrategyFixed)
+
+	cases := map[string]string{
+		"This is a kerfuffle opinion I need to share with the world": "This is a **** opinion I need to share with the world",
+		"I really need a kerfuffle! to go to bed sooner, Fornax !":   "I really need a ****! to go to bed sooner, **** !",
+		"(SHARBERT), \"kerfuffle\"...":                               "(****), \"****\"...",
+		"kerfuffles are fine":                                        "kerfuffles are fine",
+		"  spacing   is kept\tkerfuffle\n":                           "  spacing   is kept\t****\n",
+	}
+	for input, expected := range cases {
+		if got := filter.Clean(input); got != expected {
+			t.Errorf("Clean(%q) expected %q got %q", input, expected, got)
+		}
+	}
+}
+
+func TestCleanUnicode(t *testing.T) {
+	filter := NewFilter([]string{"çüş"}, StrategyMask)
+
+	got := filter.Clean("Oh ÇÜŞ, really?")
+	if got != "Oh ***, really?" {
+		t.Errorf("Expected unicode word to be masked got %q", got)
+	}
+}
+
+func TestStrategies(t *testing.T) {
+	input := "what a Kerfuffle."
+	expected := map[Strategy]string{
+		StrategyFixed:       "what a ****.",
+		StrategyMask:        "what a *********.",
+		StrategyFirstLetter: "what a K********.",
+	}
+	for strategy, want := range expected {
+		got := NewFilter(DefaultWords, strategy).Clean(input)
+		if got != want {
+			t.Errorf("Strategy %v expected %q got %q", strategy, want, got)
+		}
+	}
+
+	_, err := ParseStrategy("explode")
+	if err == nil {
+		t.Error("Expected unknown strategy to return an error")
+	}
+}
+
+func TestAddRemove(t *testing.T) {
+	filter := NewFilter(nil, StrategyFixed)
+	if filter.Add("two words") {
+		t.Error("Expected a phrase to be rejected")
+	}
+	filter.Add(" Gale ")
+	if got := filter.Clean("Gale!"); got != "****!" {
+		t.Errorf("Expected added word to be filtered got %q", got)
+	}
+	filter.Remove("GALE")
+	if got := filter.Clean("Gale!"); got != "Gale!" {
+		t.Errorf("Expected removed word to be kept got %q", got)
+	}
+}
+
+func TestReplace(t *testing.T) {
+	filter := NewFilter([]string{"gale", "tuco"}, StrategyFixed)
+	filter.Replace([]string{"Tuco", "hector", "two words"})
+	if got := strings.Join(filter.Words(), ","); got != "hector,tuco" {
+		t.Errorf("Expected the list to be replaced got %q", got)
+	}
+	if got := filter.Clean("Gale and Hector"); got != "Gale and ****" {
+		t.Errorf("Expected only the new words to be filtered got %q", got)
+	}
+}
+
+func TestLoadWordList(t *testing.T) {
+	words, err := LoadWordList(strings.NewReader("# banned words\nKerfuffle\n\n  fornax  \n"))
+	if err != nil {
+		t.Fatalf("LoadWordList returned an error: %v", err)
+	}
+	if (len(words) != 2) || (words[0] != "kerfuffle") || (words[1] != "fornax") {
+		t.Errorf("Got %v", words)
+	}
+
+	_, err = LoadWordList(strings.NewReader("not-a-word\n"))
+	if err == nil {
+		t.Error("Expected punctuation in a word to return an error")
+	}
+}
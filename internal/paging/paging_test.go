@@ -0,0 +1,67 @@
+package paging
+
+import (
+	"encoding/base64"
+	"math"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	createdAt := time.Date(2024, 3, 1, 12, 30, 45, 123456789, time.FixedZone("CET", 3600))
+	id := uuid.New()
+	gotTime, gotID, err := DecodeCursor(EncodeCursor(createdAt, id))
+	if err != nil {
+		t.Fatalf("DecodeCursor returned an error: %v", err)
+	}
+	if !gotTime.Equal(createdAt) || (gotID != id) {
+		t.Errorf("Expected %v %v got %v %v", createdAt, id, gotTime, gotID)
+	}
+}
+
+func TestDecodeCursorMalformed(t *testing.T) {
+	enc := func(raw string) string { return base64.RawURLEncoding.EncodeToString([]byte(raw)) }
+	cases := map[string]string{
+		"not base64":      "!!!",
+		"no separator":    enc("2024-03-01T12:30:45Z"),
+		"bad time":        enc("yesterday|" + uuid.NewString()),
+		"bad id":          enc("2024-03-01T12:30:45Z|walt"),
+		"padded base64":   base64.URLEncoding.EncodeToString([]byte("2024-03-01T12:30:45Z|" + uuid.NewString() + "x")),
+		"empty":           "",
+		"offset not pair": EncodeOffset(20),
+	}
+	for name, cursor := range cases {
+		if _, _, err := DecodeCursor(cursor); err == nil {
+			t.Errorf("%s: expected DecodeCursor(%q) to fail", name, cursor)
+		}
+	}
+}
+
+func TestOffsetRoundTrip(t *testing.T) {
+	for _, offset := range []int{0, 20, math.MaxInt32} {
+		got, err := DecodeOffset(EncodeOffset(offset))
+		if (err != nil) || (int(got) != offset) {
+			t.Errorf("Expected %v got %v (%v)", offset, got, err)
+		}
+	}
+}
+
+func TestDecodeOffsetMalformed(t *testing.T) {
+	enc := func(raw string) string { return base64.RawURLEncoding.EncodeToString([]byte(raw)) }
+	cases := map[string]string{
+		"not base64":  "!!!",
+		"not number":  enc("twenty"),
+		"negative":    enc("-1"),
+		"above int32": enc(strconv.Itoa(math.MaxInt32 + 1)),
+		"keyset":      EncodeCursor(time.Now(), uuid.New()),
+		"empty":       "",
+	}
+	for name, cursor := range cases {
+		if _, err := DecodeOffset(cursor); err == nil {
+			t.Errorf("%s: expected DecodeOffset(%q) to fail", name, cursor)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+// Package search turns what users type into a search box into Postgres
+// full-text queries.
+package search
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+)
+
+// TSQuery turns a search box string into a to_tsquery expression. Words are
+// ANDed together, "quoted words" must appear as a phrase and a trailing * makes
+// a word match as a prefix. Anything that is not a letter or digit is dropped
+// so user input can never break the tsquery syntax. Stop words are left to
+// to_tsquery, which ignores them.
+func TSQuery(q string) (string, error) {
+	var terms []string
+	cleanWord := func(word string) string {
+		return strings.Map(func(c rune) rune {
+			if unicode.IsLetter(c) || unicode.IsDigit(c) {
+				return c
+			}
+			return -1
+		}, word)
+	}
+	for i, part := range strings.Split(q, "\"") {
+		if i%2 == 1 {
+			var phrase []string
+			for _, word := range strings.Fields(part) {
+				if word = cleanWord(word); word != "" {
+					phrase = append(phrase, word)
+				}
+			}
+			if len(phrase) > 0 {
+				terms = append(terms, "("+strings.Join(phrase, " <-> ")+")")
+			}
+			continue
+		}
+		for _, word := range strings.Fields(part) {
+			prefix := strings.HasSuffix(word, "*")
+			if word = cleanWord(word); word == "" {
+				continue
+			}
+			if prefix {
+				word += ":*"
+			}
+			terms = append(terms, word)
+		}
+	}
+	if len(terms) == 0 {
+		return "", errors.New("search query is empty")
+	}
+	return strings.Join(terms, " & "), nil
+}
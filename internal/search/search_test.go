@@ -0,0 +1,41 @@
+package search
+
+import "testing"
+
+func TestTSQuery(t *testing.T) {
+	cases := map[string]string{
+		"walter white":         "walter & white",
+		"  walter\twhite  ":    "walter & white",
+		`"blue sky" meth`:      "(blue <-> sky) & meth",
+		`meth "say my name"`:   "meth & (say <-> my <-> name)",
+		`"heisenberg"`:         "(heisenberg)",
+		"heisen*":              "heisen:*",
+		"heisen* white":        "heisen:* & white",
+		"he*is*":               "heis:*",
+		"walt's car!":          "walts & car",
+		"a & b | !c <-> (d):*": "a & b & c & d:*",
+		`"unclosed phrase`:     "(unclosed <-> phrase)",
+		`"" walter ""`:         "walter",
+		"the a of":             "the & a & of",
+		"Größe naïve":          "Größe & naïve",
+		`"blue sky*" heisen*`:  "(blue <-> sky) & heisen:*",
+	}
+	for input, want := range cases {
+		got, err := TSQuery(input)
+		if err != nil {
+			t.Errorf("TSQuery(%q) returned an error: %v", input, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("TSQuery(%q) expected %q got %q", input, want, got)
+		}
+	}
+}
+
+func TestTSQueryEmpty(t *testing.T) {
+	for _, input := range []string{"", "   ", `""`, `" "`, "*", "!!! &&& |", `"?!" ***`} {
+		if got, err := TSQuery(input); err == nil {
+			t.Errorf("TSQuery(%q) expected an error got %q", input, got)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+// Package throttle slows down repeated failures, like wrong passwords, per
+// key. Every failure past a few free ones doubles the wait before the next
+// attempt, and enough of them lock the key out for a while. Handlers only see
+// the Limiter interface so the counters can live somewhere shared between
+// instances later without touching them.
+package throttle
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Policy decides how long a key waits after a number of failures.
+type Policy struct {
+	// FreeAttempts failures in a row cost nothing.
+	FreeAttempts int
+	// BaseDelay is the wait after the first failure past FreeAttempts. It
+	// doubles with each further failure, up to MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// LockoutAfter failures lock the key for LockoutDuration. Every failure
+	// after that, once the lockout has passed, locks it again.
+	LockoutAfter    int
+	LockoutDuration time.Duration
+	// Window is how long a key has to go without failing before its count
+	// starts over.
+	Window time.Duration
+}
+
+// Delay is the wait that follows the failures-th failure in a row.
+func (p Policy) Delay(failures int) time.Duration {
+	if failures >= p.LockoutAfter {
+		return p.LockoutDuration
+	}
+	if failures <= p.FreeAttempts {
+		return 0
+	}
+	delay := p.BaseDelay
+	for i := p.FreeAttempts + 1; i < failures; i++ {
+		delay *= 2
+		if delay >= p.MaxDelay {
+			return p.MaxDelay
+		}
+	}
+	return min(delay, p.MaxDelay)
+}
+
+// Result describes a key after a failure or an attempt was recorded.
+type Result struct {
+	// Allowed is set by Attempt when the attempt was counted and may go
+	// ahead. When it is not, RetryAfter is the wait that is left.
+	Allowed    bool
+	Failures   int
+	RetryAfter time.Duration
+	// Locked is set when this failure started a lockout.
+	Locked bool
+}
+
+type Limiter interface {
+	// Wait returns how long key has to wait before it may try again, zero
+	// if it may try now.
+	Wait(ctx context.Context, key string) (time.Duration, error)
+	// Fail records a failed attempt for key.
+	Fail(ctx context.Context, key string) (Result, error)
+	// Attempt counts a failure for key up front, unless key still has to
+	// wait. Checking Wait and calling Fail afterwards lets concurrent tries
+	// all pass before any of them is counted; Attempt does both at once, and
+	// a try that turns out to succeed gives its count back with Refund.
+	Attempt(ctx context.Context, key string) (Result, error)
+	// Refund takes back one attempt counted by Attempt, after it succeeded.
+	// The wait it started is kept, so it can not be used to skip a delay.
+	Refund(ctx context.Context, key string) error
+	// Reset forgets the failures of key, after it succeeded.
+	Reset(ctx context.Context, key string) error
+}
+
+type entry struct {
+	failures     int
+	lastFailure  time.Time
+	blockedUntil time.Time
+}
+
+// MemoryLimiter keeps the counters in process. They are lost on restart and
+// not shared between instances, so each instance throttles on its own.
+type MemoryLimiter struct {
+	policy    Policy
+	now       func() time.Time
+	mu        sync.Mutex
+	entries   map[string]*entry
+	lastSweep time.Time
+}
+
+func NewMemoryLimiter(policy Policy) *MemoryLimiter {
+	return &MemoryLimiter{policy: policy, now: time.Now, entries: map[string]*entry{}}
+}
+
+func (l *MemoryLimiter) Wait(ctx context.Context, key string) (time.Duration, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	e, ok := l.entries[key]
+	if !ok {
+		return 0, nil
+	}
+	return max(e.blockedUntil.Sub(l.now()), 0), nil
+}
+
+func (l *MemoryLimiter) Fail(ctx context.Context, key string) (Result, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.fail(l.now(), key), nil
+}
+
+// fail counts a failure for key. l.mu must be held.
+func (l *MemoryLimiter) fail(now time.Time, key string) Result {
+	l.sweep(now)
+	e, ok := l.entries[key]
+	if !ok {
+		e = &entry{}
+		l.entries[key] = e
+	}
+	if now.Sub(e.lastFailure) > l.policy.Window {
+		e.failures = 0
+	}
+	e.failures++
+	e.lastFailure = now
+	delay := l.policy.Delay(e.failures)
+	e.blockedUntil = now.Add(delay)
+	return Result{Failures: e.failures, RetryAfter: delay, Locked: e.failures >= l.policy.LockoutAfter}
+}
+
+func (l *MemoryLimiter) Attempt(ctx context.Context, key string) (Result, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	if e, ok := l.entries[key]; ok && e.blockedUntil.After(now) {
+		return Result{Failures: e.failures, RetryAfter: e.blockedUntil.Sub(now)}, nil
+	}
+	res := l.fail(now, key)
+	res.Allowed = true
+	return res, nil
+}
+
+func (l *MemoryLimiter) Refund(ctx context.Context, key string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if e, ok := l.entries[key]; ok && (e.failures > 0) {
+		e.failures--
+	}
+	return nil
+}
+
+func (l *MemoryLimiter) Reset(ctx context.Context, key string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.entries, key)
+	return nil
+}
+
+// sweep drops keys that are neither blocked nor inside their window, at most
+// once per window, so the map does not grow with every address ever seen.
+func (l *MemoryLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < l.policy.Window {
+		return
+	}
+	l.lastSweep = now
+	for key, e := range l.entries {
+		if now.After(e.blockedUntil) && (now.Sub(e.lastFailure) > l.policy.Window) {
+			delete(l.entries, key)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package throttle
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+var testPolicy = Policy{
+	FreeAttempts:    3,
+	BaseDelay:       time.Second,
+	MaxDelay:        time.Minute,
+	LockoutAfter:    10,
+	LockoutDuration: 15 * time.Minute,
+	Window:          time.Hour,
+}
+
+func TestDelay(t *testing.T) {
+	cases := map[int]time.Duration{
+		1:  0,
+		3:  0,
+		4:  time.Second,
+		5:  2 * time.Second,
+		6:  4 * time.Second,
+		9:  32 * time.Second,
+		10: 15 * time.Minute,
+		50: 15 * time.Minute,
+	}
+	for failures, want := range cases {
+		if got := testPolicy.Delay(failures); got != want {
+			t.Errorf("Delay(%v) = %v, want %v", failures, got, want)
+		}
+	}
+	capped := testPolicy
+	capped.LockoutAfter = 100
+	if got := capped.Delay(40); got != time.Minute {
+		t.Errorf("Expected delay to be capped at a minute got %v", got)
+	}
+}
+
+func TestMemoryLimiter(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1700000000, 0)
+	l := NewMemoryLimiter(testPolicy)
+	l.now = func() time.Time { return now }
+
+	for range 3 {
+		res, _ := l.Fail(ctx, "walt")
+		if res.RetryAfter != 0 {
+			t.Fatalf("Expected free attempts got a wait of %v", res.RetryAfter)
+		}
+	}
+	res, _ := l.Fail(ctx, "walt")
+	if res.RetryAfter != time.Second {
+		t.Errorf("Expected a one second wait got %v", res.RetryAfter)
+	}
+	if wait, _ := l.Wait(ctx, "walt"); wait != time.Second {
+		t.Errorf("Expected Wait to report one second got %v", wait)
+	}
+	if wait, _ := l.Wait(ctx, "jesse"); wait != 0 {
+		t.Errorf("Expected other keys to be unaffected got %v", wait)
+	}
+
+	now = now.Add(time.Second)
+	if wait, _ := l.Wait(ctx, "walt"); wait != 0 {
+		t.Errorf("Expected the wait to be over got %v", wait)
+	}
+
+	for range 6 {
+		res, _ = l.Fail(ctx, "walt")
+	}
+	if !res.Locked || (res.RetryAfter != testPolicy.LockoutDuration) {
+		t.Errorf("Expected a lockout after 10 failures got %+v", res)
+	}
+
+	l.Reset(ctx, "walt")
+	if wait, _ := l.Wait(ctx, "walt"); wait != 0 {
+		t.Errorf("Expected Reset to clear the lockout got %v", wait)
+	}
+}
+
+func TestMemoryLimiterWindow(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1700000000, 0)
+	l := NewMemoryLimiter(testPolicy)
+	l.now = func() time.Time { return now }
+
+	for range 4 {
+		l.Fail(ctx, "walt")
+	}
+	now = now.Add(2 * time.Hour)
+	res, _ := l.Fail(ctx, "walt")
+	if res.Failures != 1 {
+		t.Errorf("Expected the count to start over after the window got %v", res.Failures)
+	}
+	if _, ok := l.entries["walt"]; !ok {
+		t.Error("Expected the active key to survive the sweep")
+	}
+}
+
+func TestMemoryLimiterAttempt(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1700000000, 0)
+	l := NewMemoryLimiter(testPolicy)
+	l.now = func() time.Time { return now }
+
+	for i := range 4 {
+		res, _ := l.Attempt(ctx, "walt")
+		if !res.Allowed || (res.Failures != i+1) {
+			t.Fatalf("Expected attempt %v to be counted and allowed got %+v", i+1, res)
+		}
+	}
+	// The fourth attempt is past the free ones, so a concurrent fifth has
+	// to wait even though none of them has failed yet.
+	res, _ := l.Attempt(ctx, "walt")
+	if res.Allowed || (res.RetryAfter != time.Second) || (res.Failures != 4) {
+		t.Errorf("Expected a blocked attempt with a one second wait got %+v", res)
+	}
+
+	l.Refund(ctx, "walt")
+	if l.entries["walt"].failures != 3 {
+		t.Errorf("Expected Refund to give one attempt back got %v", l.entries["walt"].failures)
+	}
+	if wait, _ := l.Wait(ctx, "walt"); wait != time.Second {
+		t.Errorf("Expected Refund to keep the wait got %v", wait)
+	}
+	l.Refund(ctx, "jesse")
+	if _, ok := l.entries["jesse"]; ok {
+		t.Error("Expected Refund of an unknown key to do nothing")
+	}
+}
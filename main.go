@@ -1,60 +1,276 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
+	"math"
+	"net"
 	"net/http"
+	netmail "net/mail"
+	"net/url"
 	"os"
-	"sort"
+	"slices"
+	"strconv"
 	"strings"
 	"sync/atomic"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/google/uuid"
 	"github.com/joho/godotenv"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 	"github.com/mgenc2077/bootdev-chirpy/internal/auth"
 	"github.com/mgenc2077/bootdev-chirpy/internal/database"
+	"github.com/mgenc2077/bootdev-chirpy/internal/mail"
+	"github.com/mgenc2077/bootdev-chirpy/internal/moderation"
+	"github.com/mgenc2077/bootdev-chirpy/internal/paging"
+	"github.com/mgenc2077/bootdev-chirpy/internal/search"
+	"github.com/mgenc2077/bootdev-chirpy/internal/throttle"
+	"github.com/skip2/go-qrcode"
 )
 
 type apiConfig struct {
 	fileserverHits atomic.Int32
+	db             *sql.DB
 	dbQueries      *database.Queries
 	platform       string
-	jwt_Secret     string
+	jwt_config     *auth.JWTConfig
 	polka_key      string
+	admin_email    string
+	profanity      *moderation.Filter
+	mailer         mail.Mailer
+	base_url       string
+	// require_verified_email stops accounts that have not confirmed their
+	// email from posting chirps.
+	require_verified_email bool
+	// Failed logins are throttled per email and per client IP.
+	login_email_throttle throttle.Limiter
+	login_ip_throttle    throttle.Limiter
+	totp_throttle        throttle.Limiter
+	reset_email_throttle throttle.Limiter
+	reset_ip_throttle    throttle.Limiter
+	password_policy      auth.PasswordPolicy
 }
 type errordata struct {
 	Error string `json:"error"`
 }
+type policyErrordata struct {
+	Error      string                 `json:"error"`
+	Violations []auth.PolicyViolation `json:"violations"`
+}
 type emailquery struct {
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	Email    string  `json:"email"`
+	Password string  `json:"password"`
+	Handle   *string `json:"handle,omitempty"`
 }
 type User struct {
-	ID            uuid.UUID `json:"id"`
-	CreatedAt     time.Time `json:"created_at"`
-	UpdatedAt     time.Time `json:"updated_at"`
-	Email         string    `json:"email"`
-	Token         *string   `json:"token,omitempty"`
-	Refresh_token *string   `json:"refresh_token,omitempty"`
-	Is_chirpy_red bool      `json:"is_chirpy_red"`
+	ID             uuid.UUID `json:"id"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+	Email          string    `json:"email"`
+	Handle         *string   `json:"handle"`
+	Token          *string   `json:"token,omitempty"`
+	Refresh_token  *string   `json:"refresh_token,omitempty"`
+	Is_chirpy_red  bool      `json:"is_chirpy_red"`
+	Role           string    `json:"role"`
+	Email_verified bool      `json:"email_verified"`
 }
 type chirpsInput struct {
-	Body   string    `json:"body"`
-	UserID uuid.UUID `json:"user_id"`
+	Body       string     `json:"body"`
+	UserID     uuid.UUID  `json:"user_id"`
+	ParentID   *uuid.UUID `json:"parent_id"`
+	Kind       string     `json:"-"`
+	OriginalID *uuid.UUID `json:"-"`
 }
 type chirpsOutput struct {
-	ID        uuid.UUID `json:"id"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-	Body      string    `json:"body"`
-	UserID    uuid.UUID `json:"user_id"`
+	ID              uuid.UUID     `json:"id"`
+	CreatedAt       time.Time     `json:"created_at"`
+	UpdatedAt       time.Time     `json:"updated_at"`
+	Body            string        `json:"body"`
+	UserID          uuid.UUID     `json:"user_id"`
+	ParentID        *uuid.UUID    `json:"parent_id"`
+	Kind            string        `json:"kind"`
+	Original        *chirpsOutput `json:"original,omitempty"`
+	OriginalDeleted bool          `json:"original_deleted,omitempty"`
+	LikeCount       int64         `json:"like_count"`
+	LikedByMe       *bool         `json:"liked_by_me,omitempty"`
+	Hidden          bool          `json:"hidden,omitempty"`
 }
-type tokenstruct struct {
+type chirpExtras struct {
+	counts    map[uuid.UUID]int64
+	liked     map[uuid.UUID]bool
+	viewer    uuid.NullUUID
+	originals map[uuid.UUID]database.Chirp
+}
+type threadNode struct {
+	chirpsOutput
+	Replies []*threadNode `json:"replies"`
+}
+type threadOutput struct {
+	Root      chirpsOutput   `json:"root"`
+	Ancestors []chirpsOutput `json:"ancestors"`
+	Chirp     *threadNode    `json:"chirp"`
+}
+type chirpRevisionOutput struct {
+	ID         uuid.UUID `json:"id"`
+	ChirpID    uuid.UUID `json:"chirp_id"`
+	Body       string    `json:"body"`
+	CreatedAt  time.Time `json:"created_at"`
+	ReplacedAt time.Time `json:"replaced_at"`
+}
+type chirpsPage struct {
+	Chirps     []chirpsOutput `json:"chirps"`
+	NextCursor *string        `json:"next_cursor"`
+}
+type pageParams struct {
+	Ascending       bool
+	Limit           int32
+	CursorCreatedAt sql.NullTime
+	CursorID        uuid.NullUUID
+}
+type followOutput struct {
+	UserID     uuid.UUID `json:"user_id"`
+	FollowedAt time.Time `json:"followed_at"`
+}
+type followsPage struct {
+	Users      []followOutput `json:"users"`
+	NextCursor *string        `json:"next_cursor"`
+}
+type trendingHashtag struct {
+	Tag      string `json:"tag"`
+	UseCount int64  `json:"use_count"`
+}
+type roleInput struct {
+	Role string `json:"role"`
+}
+type bannedWordInput struct {
+	Word string `json:"word"`
+}
+type reportInput struct {
+	Reason string `json:"reason"`
+}
+type reportOutput struct {
+	ID         uuid.UUID     `json:"id"`
+	ChirpID    uuid.UUID     `json:"chirp_id"`
+	ReporterID uuid.UUID     `json:"reporter_id"`
+	Reason     string        `json:"reason"`
+	CreatedAt  time.Time     `json:"created_at"`
+	Chirp      *chirpsOutput `json:"chirp,omitempty"`
+}
+type reportsPage struct {
+	Reports    []reportOutput `json:"reports"`
+	NextCursor *string        `json:"next_cursor"`
+}
+type sessionOutput struct {
+	ID         uuid.UUID `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	StartedAt  time.Time `json:"started_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+type apiKeyInput struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+type apiKeyOutput struct {
+	ID         uuid.UUID  `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	Key        *string    `json:"key,omitempty"`
+}
+type oauthClientInput struct {
+	Name         string   `json:"name"`
+	RedirectURIs []string `json:"redirect_uris"`
+	Scopes       []string `json:"scopes"`
+	Public       bool     `json:"public"`
+}
+type oauthClientOutput struct {
+	ClientID     uuid.UUID `json:"client_id"`
+	Name         string    `json:"name"`
+	RedirectURIs []string  `json:"redirect_uris"`
+	Scopes       []string  `json:"scopes"`
+	Public       bool      `json:"public"`
+	CreatedAt    time.Time `json:"created_at"`
+	ClientSecret *string   `json:"client_secret,omitempty"`
+}
+type authorizeInput struct {
+	ResponseType        string `json:"response_type"`
+	ClientID            string `json:"client_id"`
+	RedirectURI         string `json:"redirect_uri"`
+	Scope               string `json:"scope"`
+	State               string `json:"state"`
+	CodeChallenge       string `json:"code_challenge"`
+	CodeChallengeMethod string `json:"code_challenge_method"`
+	Approve             bool   `json:"approve"`
+}
+type authorizeOutput struct {
+	ClientID    uuid.UUID `json:"client_id"`
+	ClientName  string    `json:"client_name"`
+	RedirectURI string    `json:"redirect_uri"`
+	Scopes      []string  `json:"scopes"`
+	Consented   bool      `json:"consented"`
+}
+type authorizeRedirect struct {
+	RedirectTo string `json:"redirect_to"`
+}
+type oauthTokenOutput struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+	Scope        string `json:"scope"`
+}
+type oauthErrordata struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+type authorizationOutput struct {
+	ClientID   uuid.UUID `json:"client_id"`
+	ClientName string    `json:"client_name"`
+	Scopes     []string  `json:"scopes"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+type twoFactorInput struct {
+	Code           string `json:"code"`
+	RecoveryCode   string `json:"recovery_code"`
+	Password       string `json:"password"`
+	ChallengeToken string `json:"challenge_token"`
+}
+type totpEnrollOutput struct {
+	Secret     string `json:"secret"`
+	OtpauthURI string `json:"otpauth_uri"`
+	QRCodeURL  string `json:"qr_code_url"`
+}
+type recoveryCodesOutput struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+type loginChallengeOutput struct {
+	TwoFactorRequired bool      `json:"two_factor_required"`
+	ChallengeToken    string    `json:"challenge_token"`
+	ExpiresAt         time.Time `json:"expires_at"`
+}
+type passwordResetInput struct {
+	Email    string `json:"email"`
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+type verifyEmailInput struct {
 	Token string `json:"token"`
 }
+type tokenstruct struct {
+	Token         string  `json:"token"`
+	Refresh_token *string `json:"refresh_token,omitempty"`
+}
 type polkaInput struct {
 	Event string `json:"event"`
 	Data  struct {
@@ -69,8 +285,102 @@ func (cfg *apiConfig) middlewareMetricsInc(next http.Handler) http.Handler {
 	})
 }
 
+// middlewareRequireRole only lets requests through whose JWT carries role or a
+// higher one and the account scope of a login. The role is read from the
+// token, so a role change takes effect once the user's current access token
+// expires.
+func (cfg *apiConfig) middlewareRequireRole(role string, next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, err := auth.GetBearerToken(r.Header)
+		if err != nil {
+			returnwitherror(w, 401, "No token Provided")
+			return
+		}
+		claims, err := auth.ValidateJWTClaims(token, cfg.jwt_config)
+		if err != nil {
+			returnwitherror(w, 401, "Jwt could not be validated")
+			return
+		}
+		if !auth.HasScope(claims.Scopes(), auth.ScopeAccount) {
+			returnwitherror(w, 403, "Token does not have the "+auth.ScopeAccount+" scope")
+			return
+		}
+		if !auth.HasRole(claims.Role, role) {
+			returnwitherror(w, 403, "Insufficient role")
+			return
+		}
+		next(w, r)
+	})
+}
+
 var apiconfig *apiConfig
 
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+const (
+	minHandleLength      = 3
+	maxHandleLength      = 15
+	maxHashtagLength     = 50
+	defaultTrendWindow   = 24 * time.Hour
+	maxTrendWindow       = 30 * 24 * time.Hour
+	defaultTrendingLimit = 10
+)
+
+const maxReportReasonLength = 500
+
+// bannedWordsReloadInterval bounds how long other instances keep filtering
+// with a word list changed through /admin/moderation/words.
+const bannedWordsReloadInterval = time.Minute
+
+const maxAPIKeyNameLength = 100
+
+const (
+	maxOAuthClientNameLength = 100
+	maxRedirectURIs          = 10
+)
+
+const maxUserAgentLength = 512
+
+// maxEmailLength is the longest address SMTP can deliver to (RFC 5321).
+const maxEmailLength = 254
+
+// A single account gets a few tries before backing off and is locked after
+// ten failures, which is plenty for a forgotten password. An IP gets more
+// room since many users can share one behind a NAT, but not enough to try a
+// leaked password list against every account.
+var (
+	loginEmailPolicy = throttle.Policy{FreeAttempts: 3, BaseDelay: time.Second, MaxDelay: time.Minute, LockoutAfter: 10, LockoutDuration: 15 * time.Minute, Window: time.Hour}
+	loginIPPolicy    = throttle.Policy{FreeAttempts: 20, BaseDelay: time.Second, MaxDelay: time.Minute, LockoutAfter: 100, LockoutDuration: 15 * time.Minute, Window: time.Hour}
+	// Codes checked for a logged in user, outside of /api/login/2fa, get the
+	// same room as an account at login.
+	totpPolicy = throttle.Policy{FreeAttempts: 3, BaseDelay: time.Second, MaxDelay: time.Minute, LockoutAfter: 10, LockoutDuration: 15 * time.Minute, Window: time.Hour}
+	// Every password reset request sends an email, so they are counted
+	// whether or not the email has an account, and an inbox gets a few
+	// before they slow down to minutes apart.
+	resetEmailPolicy = throttle.Policy{FreeAttempts: 3, BaseDelay: time.Minute, MaxDelay: 15 * time.Minute, LockoutAfter: 10, LockoutDuration: time.Hour, Window: 24 * time.Hour}
+	resetIPPolicy    = throttle.Policy{FreeAttempts: 20, BaseDelay: time.Minute, MaxDelay: 15 * time.Minute, LockoutAfter: 100, LockoutDuration: time.Hour, Window: 24 * time.Hour}
+)
+
+const (
+	totpIssuer           = "Chirpy"
+	totpQRSize           = 256
+	maxChallengeAttempts = 5
+)
+
+const (
+	reportDismissed = "dismissed"
+	reportHidden    = "hidden"
+)
+
+const (
+	chirpKindChirp   = "chirp"
+	chirpKindRechirp = "rechirp"
+	chirpKindQuote   = "quote"
+)
+
 func returnwitherror(w http.ResponseWriter, code int, msg string) int {
 	w.Header().Set("Content-Type", "application/json")
 	check := 1
@@ -81,123 +391,1717 @@ func returnwitherror(w http.ResponseWriter, code int, msg string) int {
 	return check
 }
 
-func createChirp(w http.ResponseWriter, code int, bodydata chirpsInput, r *http.Request) {
+// checkPassword answers 400 listing every rule of the password policy that
+// password breaks. emails are the addresses of the account it is for.
+func checkPassword(w http.ResponseWriter, password string, emails ...string) bool {
+	violations := apiconfig.password_policy.Check(password, emails...)
+	if len(violations) == 0 {
+		return true
+	}
+	errjson, err := json.Marshal(policyErrordata{Error: "Password does not meet the password policy", Violations: violations})
+	if err != nil {
+		returnwitherror(w, 500, "Could not marshall violations")
+		return false
+	}
 	w.Header().Set("Content-Type", "application/json")
-	arr := strings.Split(bodydata.Body, " ")
-	var arres []string
-	for _, v := range arr {
-		val1 := strings.ToLower(v)
-		if (val1 == "kerfuffle") || (val1 == "sharbert") || (val1 == "fornax") {
-			arres = append(arres, "****")
-			continue
+	w.WriteHeader(400)
+	w.Write(errjson)
+	return false
+}
+
+func apiKeyToOutput(apikey database.ApiKey) apiKeyOutput {
+	output := apiKeyOutput{ID: apikey.ID, Name: apikey.Name, Prefix: apikey.KeyPrefix, Scopes: apikey.Scopes, CreatedAt: apikey.CreatedAt}
+	if apikey.LastUsedAt.Valid {
+		output.LastUsedAt = &apikey.LastUsedAt.Time
+	}
+	return output
+}
+
+func chirpToOutput(chirp database.Chirp) chirpsOutput {
+	out := chirpsOutput{ID: chirp.ID, CreatedAt: chirp.CreatedAt, UpdatedAt: chirp.UpdatedAt, Body: chirp.Body, UserID: chirp.UserID, Kind: chirp.Kind}
+	if chirp.ParentID.Valid {
+		out.ParentID = &chirp.ParentID.UUID
+	}
+	out.Hidden = chirp.HiddenAt.Valid
+	return out
+}
+
+// optionalViewer returns the caller's user id when the request carries a valid
+// bearer token. Endpoints that are public but personalised use it; a missing or
+// bad token just means an anonymous viewer.
+func optionalViewer(r *http.Request) uuid.NullUUID {
+	if key, err := auth.GetAPIKey(r.Header); err == nil {
+		apikey, err := findAPIKey(r.Context(), key)
+		if (err != nil) || !auth.HasScope(apikey.Scopes, auth.ScopeChirpsRead) {
+			return uuid.NullUUID{}
 		}
-		arres = append(arres, v)
+		return uuid.NullUUID{UUID: apikey.UserID, Valid: true}
 	}
-	rspstring := strings.Join(arres, " ")
-	chirp, err := apiconfig.dbQueries.CreateChirp(r.Context(), database.CreateChirpParams{Body: rspstring, UserID: bodydata.UserID})
+	token, err := auth.GetBearerToken(r.Header)
 	if err != nil {
-		returnwitherror(w, 500, "Could not create Chirp")
-		return
+		return uuid.NullUUID{}
 	}
-	chirpresp := chirpsOutput{ID: chirp.ID, CreatedAt: chirp.CreatedAt, UpdatedAt: chirp.UpdatedAt, Body: chirp.Body, UserID: chirp.UserID}
-	rspjson, err := json.Marshal(chirpresp)
+	claims, err := auth.ValidateJWTClaims(token, apiconfig.jwt_config)
+	if (err != nil) || !auth.HasScope(claims.Scopes(), auth.ScopeChirpsRead) {
+		return uuid.NullUUID{}
+	}
+	viewerid, err := uuid.Parse(claims.Subject)
 	if err != nil {
-		returnwitherror(w, 500, "Could not marshall chirpresp")
-		return
+		return uuid.NullUUID{}
 	}
-	w.WriteHeader(code)
-	w.Write(rspjson)
+	return uuid.NullUUID{UUID: viewerid, Valid: true}
 }
 
-func getchirps(w http.ResponseWriter, code int, r *http.Request, authorID string, sortvalue string) {
-	w.Header().Set("Content-Type", "application/json")
-	arr := []chirpsOutput{}
-	var chirps []database.Chirp
-	var err error
-	if authorID != "" {
-		suuid, err := uuid.Parse(authorID)
+// authenticate identifies the caller of a handler that needs scope. Every
+// handler that needs a user names its scope here: the access token of a login
+// has all of them, while API keys and tokens issued to OAuth clients only have
+// the ones they were given and never auth.ScopeAccount. It answers 401 or 403
+// itself.
+func authenticate(w http.ResponseWriter, r *http.Request, scope string) (uuid.UUID, bool) {
+	if key, err := auth.GetAPIKey(r.Header); err == nil {
+		apikey, err := findAPIKey(r.Context(), key)
 		if err != nil {
-			returnwitherror(w, 400, "Could not find UserID")
-			return
+			returnwitherror(w, 401, "API key is invalid or revoked")
+			return uuid.Nil, false
 		}
-		chirps, err = apiconfig.dbQueries.GetChirpsByAuthor(r.Context(), suuid)
-		if err != nil {
-			returnwitherror(w, 500, "Could not get chirps")
-			return
+		if !auth.HasScope(apikey.Scopes, scope) {
+			returnwitherror(w, 403, "API key does not have the "+scope+" scope")
+			return uuid.Nil, false
 		}
-	} else {
-		chirps, err = apiconfig.dbQueries.GetChirps(r.Context())
+		return apikey.UserID, true
+	}
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		returnwitherror(w, 401, "No token Provided")
+		return uuid.Nil, false
+	}
+	claims, err := auth.ValidateJWTClaims(token, apiconfig.jwt_config)
+	if err != nil {
+		returnwitherror(w, 401, "Jwt could not be validated")
+		return uuid.Nil, false
+	}
+	userid, err := uuid.Parse(claims.Subject)
+	if err != nil {
+		returnwitherror(w, 401, "Jwt could not be validated")
+		return uuid.Nil, false
+	}
+	if !auth.HasScope(claims.Scopes(), scope) {
+		returnwitherror(w, 403, "Token does not have the "+scope+" scope")
+		return uuid.Nil, false
+	}
+	return userid, true
+}
+
+// findAPIKey looks up an active key and notes that it was used. last_used_at
+// is only written about once a minute, so a busy bot does not turn every read
+// into a write.
+func findAPIKey(ctx context.Context, key string) (database.ApiKey, error) {
+	apikey, err := apiconfig.dbQueries.GetAPIKeyByHash(ctx, auth.HashToken(key))
+	if err != nil {
+		return apikey, err
+	}
+	err = apiconfig.dbQueries.TouchAPIKey(ctx, apikey.ID)
+	if err != nil {
+		log.Printf("could not update last use of API key %v: %v", apikey.ID, err)
+	}
+	return apikey, nil
+}
+
+// chirpVisible reports whether viewer may see chirp. Chirps hidden by a
+// moderator stay visible to their author only.
+func chirpVisible(chirp database.Chirp, viewer uuid.NullUUID) bool {
+	return !chirp.HiddenAt.Valid || (viewer.Valid && viewer.UUID == chirp.UserID)
+}
+
+// loadChirpExtras batch-loads what chirpsOutput needs beyond the chirp row: the
+// embedded originals of rechirps and quotes, like counts, and liked_by_me when
+// the request carries a valid bearer token. Each is one query for the whole
+// batch, so listing chirps never turns into a query per chirp.
+func loadChirpExtras(r *http.Request, chirps []database.Chirp) (chirpExtras, error) {
+	extras := chirpExtras{counts: map[uuid.UUID]int64{}, liked: map[uuid.UUID]bool{}, originals: map[uuid.UUID]database.Chirp{}}
+	if len(chirps) == 0 {
+		return extras, nil
+	}
+	originalIDs := []uuid.UUID{}
+	for _, v := range chirps {
+		if v.OriginalID.Valid {
+			originalIDs = append(originalIDs, v.OriginalID.UUID)
+		}
+	}
+	if len(originalIDs) > 0 {
+		originals, err := apiconfig.dbQueries.GetChirpsByIDs(r.Context(), originalIDs)
 		if err != nil {
-			returnwitherror(w, 500, "Could not get chirps")
-			return
+			return extras, err
+		}
+		for _, v := range originals {
+			extras.originals[v.ID] = v
 		}
 	}
+	ids := make([]uuid.UUID, 0, len(chirps)+len(extras.originals))
 	for _, v := range chirps {
-		arr = append(arr, chirpsOutput{ID: v.ID, CreatedAt: v.CreatedAt, UpdatedAt: v.UpdatedAt, Body: v.Body, UserID: v.UserID})
+		ids = append(ids, v.ID)
+	}
+	for id := range extras.originals {
+		ids = append(ids, id)
+	}
+	counts, err := apiconfig.dbQueries.GetLikeCounts(r.Context(), ids)
+	if err != nil {
+		return extras, err
+	}
+	for _, v := range counts {
+		extras.counts[v.ChirpID] = v.LikeCount
+	}
+	extras.viewer = optionalViewer(r)
+	if !extras.viewer.Valid {
+		return extras, nil
 	}
+	liked, err := apiconfig.dbQueries.GetLikedChirps(r.Context(), database.GetLikedChirpsParams{UserID: extras.viewer.UUID, ChirpIds: ids})
+	if err != nil {
+		return extras, err
+	}
+	for _, v := range liked {
+		extras.liked[v] = true
+	}
+	return extras, nil
+}
 
-	var ascending bool
-	if sortvalue == "ASC" {
-		ascending = true
-	} else {
-		ascending = false
+func (e chirpExtras) output(chirp database.Chirp) chirpsOutput {
+	out := e.withLikes(chirp)
+	if chirp.Kind == chirpKindChirp {
+		return out
+	}
+	original, ok := e.originals[chirp.OriginalID.UUID]
+	if !chirp.OriginalID.Valid || !ok || !chirpVisible(original, e.viewer) {
+		out.OriginalDeleted = true
+		return out
+	}
+	embedded := e.withLikes(original)
+	out.Original = &embedded
+	return out
+}
+
+func (e chirpExtras) withLikes(chirp database.Chirp) chirpsOutput {
+	out := chirpToOutput(chirp)
+	out.LikeCount = e.counts[chirp.ID]
+	if e.viewer.Valid {
+		liked := e.liked[chirp.ID]
+		out.LikedByMe = &liked
 	}
+	return out
+}
 
-	sort.SliceStable(arr, func(i, j int) bool {
-		if ascending {
-			return arr[i].CreatedAt.Before(arr[j].CreatedAt)
+// loadProfanityFilter builds the filter from the banned_words table. The
+// first start seeds the table from PROFANITY_WORDS_FILE, or the built-in
+// list, and records that it did, so words added or removed through
+// /admin/moderation/words survive restarts, even when every word is removed.
+func loadProfanityFilter(ctx context.Context, strategy moderation.Strategy) (*moderation.Filter, error) {
+	tx, err := apiconfig.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	qtx := apiconfig.dbQueries.WithTx(tx)
+	seeded, err := qtx.MarkBannedWordsSeeded(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if seeded > 0 {
+		words := moderation.DefaultWords
+		if path := os.Getenv("PROFANITY_WORDS_FILE"); path != "" {
+			words, err = moderation.LoadWordFile(path)
+			if err != nil {
+				return nil, err
+			}
 		}
-		return arr[i].CreatedAt.After(arr[j].CreatedAt)
-	})
+		for _, word := range words {
+			err = qtx.AddBannedWord(ctx, word)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	words, err := qtx.GetBannedWords(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return moderation.NewFilter(words, strategy), nil
+}
+
+// reloadBannedWords keeps the filter in step with the banned_words table, so
+// words added or removed through another instance apply here too. Changes made
+// through this instance apply right away.
+func reloadBannedWords(interval time.Duration) {
+	for range time.Tick(interval) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		words, err := apiconfig.dbQueries.GetBannedWords(ctx)
+		cancel()
+		if err != nil {
+			log.Printf("could not reload banned words: %v", err)
+			continue
+		}
+		apiconfig.profanity.Replace(words)
+	}
+}
+
+func isWordRune(c rune) bool {
+	return unicode.IsLetter(c) || unicode.IsDigit(c) || (c == '_')
+}
+
+// extractPrefixed returns the lowercased, de-duplicated words of letters, digits
+// and underscores that follow marker in body, e.g. "go" for "#Go". The marker
+// has to start after whitespace or punctuation, so "a#b" and "walt@example.com"
+// are ignored.
+func extractPrefixed(body string, marker rune) []string {
+	var words []string
+	seen := map[string]bool{}
+	runes := []rune(body)
+	for i := 0; i < len(runes); i++ {
+		if (runes[i] != marker) || ((i > 0) && (isWordRune(runes[i-1]) || (runes[i-1] == marker))) {
+			continue
+		}
+		end := i + 1
+		for (end < len(runes)) && isWordRune(runes[end]) {
+			end++
+		}
+		word := strings.ToLower(string(runes[i+1 : end]))
+		if (word != "") && !seen[word] {
+			seen[word] = true
+			words = append(words, word)
+		}
+		i = end - 1
+	}
+	return words
+}
+
+// extractHashtags returns the #tags in body. A tag must contain at least one
+// letter (so "#1" is not a tag) and be at most maxHashtagLength runes long.
+func extractHashtags(body string) []string {
+	var tags []string
+	for _, word := range extractPrefixed(body, '#') {
+		if (utf8.RuneCountInString(word) <= maxHashtagLength) && strings.IndexFunc(word, unicode.IsLetter) >= 0 {
+			tags = append(tags, word)
+		}
+	}
+	return tags
+}
+
+// extractMentions returns the @handles in body that are valid handles.
+func extractMentions(body string) []string {
+	var handles []string
+	for _, word := range extractPrefixed(body, '@') {
+		if validateHandle(word) == nil {
+			handles = append(handles, word)
+		}
+	}
+	return handles
+}
+
+func validateHandle(handle string) error {
+	if (len(handle) < minHandleLength) || (len(handle) > maxHandleLength) {
+		return fmt.Errorf("handle must be between %d and %d characters", minHandleLength, maxHandleLength)
+	}
+	for _, c := range handle {
+		if !(((c >= 'a') && (c <= 'z')) || ((c >= '0') && (c <= '9')) || (c == '_')) {
+			return errors.New("handle can only contain letters, digits and underscores")
+		}
+	}
+	return nil
+}
+
+// claimHandle validates a requested handle and checks nobody else owns it. It
+// writes the error response itself and reports whether the caller may go on.
+func claimHandle(w http.ResponseWriter, handle string, userID uuid.UUID, r *http.Request) (sql.NullString, bool) {
+	handle = strings.ToLower(strings.TrimPrefix(handle, "@"))
+	if err := validateHandle(handle); err != nil {
+		returnwitherror(w, 400, err.Error())
+		return sql.NullString{}, false
+	}
+	owner, err := apiconfig.dbQueries.UserByHandle(r.Context(), sql.NullString{String: handle, Valid: true})
+	if (err == nil) && (owner.ID != userID) {
+		returnwitherror(w, 409, "Handle is already taken")
+		return sql.NullString{}, false
+	}
+	if (err != nil) && !errors.Is(err, sql.ErrNoRows) {
+		returnwitherror(w, 500, "Could not check handle")
+		return sql.NullString{}, false
+	}
+	return sql.NullString{String: handle, Valid: true}, true
+}
+
+// handleTakenError reports whether err is the unique constraint on
+// users.handle, which claimHandle can not rule out when two requests claim
+// the same handle at once.
+func handleTakenError(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && (pqErr.Code == "23505") && (pqErr.Constraint == "users_handle_key")
+}
+
+func saveHashtags(ctx context.Context, qtx *database.Queries, chirp database.Chirp) error {
+	for _, tag := range extractHashtags(chirp.Body) {
+		hashtag, err := qtx.UpsertHashtag(ctx, tag)
+		if err != nil {
+			return err
+		}
+		err = qtx.AddChirpHashtag(ctx, database.AddChirpHashtagParams{ChirpID: chirp.ID, HashtagID: hashtag.ID, CreatedAt: chirp.CreatedAt})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-	arrjson, err := json.Marshal(arr)
+// saveMentions links the chirp to every existing user it @mentions, except its
+// own author, so they show up in that user's GET /api/mentions.
+func saveMentions(ctx context.Context, qtx *database.Queries, chirp database.Chirp) error {
+	handles := extractMentions(chirp.Body)
+	if len(handles) == 0 {
+		return nil
+	}
+	users, err := qtx.GetUsersByHandles(ctx, handles)
 	if err != nil {
-		returnwitherror(w, 500, "Could Not Marshall Chirps")
-		return
+		return err
 	}
-	w.WriteHeader(code)
-	w.Write(arrjson)
+	for _, v := range users {
+		if v.ID == chirp.UserID {
+			continue
+		}
+		err = qtx.AddChirpMention(ctx, database.AddChirpMentionParams{ChirpID: chirp.ID, UserID: v.ID, CreatedAt: chirp.CreatedAt})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func returnUser(w http.ResponseWriter, code int, userquery database.User, r *http.Request) {
-	token, err := auth.MakeJWT(userquery.ID, apiconfig.jwt_Secret)
+func createChirp(w http.ResponseWriter, code int, bodydata chirpsInput, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if apiconfig.require_verified_email {
+		author, err := apiconfig.dbQueries.UserByID(r.Context(), bodydata.UserID)
+		if err != nil {
+			returnwitherror(w, 500, "Could not find user")
+			return
+		}
+		if !author.EmailVerifiedAt.Valid {
+			returnwitherror(w, 403, "Verify your email before chirping")
+			return
+		}
+	}
+	rspstring := apiconfig.profanity.Clean(bodydata.Body)
+	parentID := uuid.NullUUID{}
+	if bodydata.ParentID != nil {
+		parent, err := apiconfig.dbQueries.GetChirp(r.Context(), *bodydata.ParentID)
+		if (err != nil) || !chirpVisible(parent, uuid.NullUUID{UUID: bodydata.UserID, Valid: true}) {
+			returnwitherror(w, 404, "Could not find parent chirp")
+			return
+		}
+		parentID = uuid.NullUUID{UUID: *bodydata.ParentID, Valid: true}
+	}
+	kind := bodydata.Kind
+	if kind == "" {
+		kind = chirpKindChirp
+	}
+	originalID := uuid.NullUUID{}
+	if bodydata.OriginalID != nil {
+		originalID = uuid.NullUUID{UUID: *bodydata.OriginalID, Valid: true}
+	}
+	tx, err := apiconfig.db.BeginTx(r.Context(), nil)
 	if err != nil {
-		returnwitherror(w, 500, "Could not make jwt")
+		returnwitherror(w, 500, "Could not create Chirp")
 		return
 	}
-	refreshToken, err := auth.MakeRefreshToken()
+	defer tx.Rollback()
+	qtx := apiconfig.dbQueries.WithTx(tx)
+	chirp, err := qtx.CreateChirp(r.Context(), database.CreateChirpParams{Body: rspstring, UserID: bodydata.UserID, ParentID: parentID, Kind: kind, OriginalID: originalID})
 	if err != nil {
-		returnwitherror(w, 500, "Could not make refresh token")
+		returnwitherror(w, 500, "Could not create Chirp")
 		return
 	}
-	userstruct := User{ID: userquery.ID, CreatedAt: userquery.CreatedAt, UpdatedAt: userquery.UpdatedAt, Email: userquery.Email, Token: &token, Refresh_token: &refreshToken, Is_chirpy_red: userquery.IsChirpyRed}
-	_, err = apiconfig.dbQueries.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{Token: *userstruct.Refresh_token, UserID: userstruct.ID})
+	err = saveHashtags(r.Context(), qtx, chirp)
 	if err != nil {
-		returnwitherror(w, 500, "Could not save refresh token")
+		returnwitherror(w, 500, "Could not save hashtags")
 		return
 	}
-	userjson, err := json.Marshal(userstruct)
+	err = saveMentions(r.Context(), qtx, chirp)
 	if err != nil {
-		returnwitherror(w, 500, "Could not marshall userstruct")
+		returnwitherror(w, 500, "Could not save mentions")
+		return
+	}
+	if err = tx.Commit(); err != nil {
+		returnwitherror(w, 500, "Could not create Chirp")
+		return
+	}
+	extras, err := loadChirpExtras(r, []database.Chirp{chirp})
+	if err != nil {
+		returnwitherror(w, 500, "Could not load chirps")
+		return
+	}
+	chirpresp := extras.output(chirp)
+	rspjson, err := json.Marshal(chirpresp)
+	if err != nil {
+		returnwitherror(w, 500, "Could not marshall chirpresp")
 		return
 	}
-	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(code)
-	w.Write(userjson)
+	w.Write(rspjson)
 }
 
-func main() {
-	godotenv.Load()
-	dbURL := os.Getenv("DB_URL")
-	db, err := sql.Open("postgres", dbURL)
-	if err != nil {
-		return
+func parseLimit(r *http.Request) (int32, error) {
+	limitstring := r.URL.Query().Get("limit")
+	if limitstring == "" {
+		return defaultPageSize, nil
 	}
-	mux := http.NewServeMux()
-	apiconfig = &apiConfig{dbQueries: database.New(db), platform: os.Getenv("PLATFORM"), jwt_Secret: os.Getenv("jwt_Secret"), polka_key: os.Getenv("POLKA_KEY")}
-	mux.Handle("/app/", apiconfig.middlewareMetricsInc(http.StripPrefix("/app/", http.FileServer(http.Dir(".")))))
+	limit, err := strconv.Atoi(limitstring)
+	if (err != nil) || (limit < 1) || (limit > maxPageSize) {
+		return 0, fmt.Errorf("limit must be between 1 and %d", maxPageSize)
+	}
+	return int32(limit), nil
+}
+
+func parsePageParams(r *http.Request) (pageParams, error) {
+	params := pageParams{Ascending: true, Limit: defaultPageSize}
+	sortvalue := r.URL.Query().Get("sort")
+	if (sortvalue != "") && (sortvalue != "asc") {
+		params.Ascending = false
+	}
+	limit, err := parseLimit(r)
+	if err != nil {
+		return params, err
+	}
+	params.Limit = limit
+	if cursor := r.URL.Query().Get("cursor"); cursor != "" {
+		createdAt, id, err := paging.DecodeCursor(cursor)
+		if err != nil {
+			return params, errors.New("invalid cursor")
+		}
+		params.CursorCreatedAt = sql.NullTime{Time: createdAt, Valid: true}
+		params.CursorID = uuid.NullUUID{UUID: id, Valid: true}
+	}
+	return params, nil
+}
+
+// writeChirpsPage expects chirps to be fetched with page.Limit+1 rows so it can
+// tell whether another page exists without a separate count query.
+func writeChirpsPage(w http.ResponseWriter, code int, chirps []database.Chirp, page pageParams, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	resp := chirpsPage{Chirps: []chirpsOutput{}}
+	if len(chirps) > int(page.Limit) {
+		chirps = chirps[:page.Limit]
+		last := chirps[len(chirps)-1]
+		cursor := paging.EncodeCursor(last.CreatedAt, last.ID)
+		resp.NextCursor = &cursor
+	}
+	extras, err := loadChirpExtras(r, chirps)
+	if err != nil {
+		returnwitherror(w, 500, "Could not load chirps")
+		return
+	}
+	for _, v := range chirps {
+		resp.Chirps = append(resp.Chirps, extras.output(v))
+	}
+	respjson, err := json.Marshal(resp)
+	if err != nil {
+		returnwitherror(w, 500, "Could Not Marshall Chirps")
+		return
+	}
+	w.WriteHeader(code)
+	w.Write(respjson)
+}
+
+// parseSearchTime accepts RFC3339 timestamps or plain dates. A plain date used
+// as the end of a range covers that whole day.
+func parseSearchTime(value string, endOfRange bool) (sql.NullTime, error) {
+	if value == "" {
+		return sql.NullTime{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err == nil {
+		return sql.NullTime{Time: t.UTC(), Valid: true}, nil
+	}
+	t, err = time.Parse(time.DateOnly, value)
+	if err != nil {
+		return sql.NullTime{}, err
+	}
+	if endOfRange {
+		t = t.AddDate(0, 0, 1)
+	}
+	return sql.NullTime{Time: t, Valid: true}, nil
+}
+
+func searchchirps(w http.ResponseWriter, code int, r *http.Request) {
+	query := r.URL.Query()
+	tsquery, err := search.TSQuery(query.Get("q"))
+	if err != nil {
+		returnwitherror(w, 400, err.Error())
+		return
+	}
+	params := database.SearchChirpsParams{Query: tsquery, ViewerID: optionalViewer(r)}
+	params.PageSize, err = parseLimit(r)
+	if err != nil {
+		returnwitherror(w, 400, err.Error())
+		return
+	}
+	if authorID := query.Get("author_id"); authorID != "" {
+		suuid, err := uuid.Parse(authorID)
+		if err != nil {
+			returnwitherror(w, 400, "Could not find UserID")
+			return
+		}
+		params.AuthorID = uuid.NullUUID{UUID: suuid, Valid: true}
+	}
+	params.Since, err = parseSearchTime(query.Get("since"), false)
+	if err != nil {
+		returnwitherror(w, 400, "Invalid since")
+		return
+	}
+	params.Until, err = parseSearchTime(query.Get("until"), true)
+	if err != nil {
+		returnwitherror(w, 400, "Invalid until")
+		return
+	}
+	// Results are ordered by rank, which has no stable keyset, so the search
+	// cursor is an opaque offset instead of a created_at/id pair.
+	if cursor := query.Get("cursor"); cursor != "" {
+		params.PageOffset, err = paging.DecodeOffset(cursor)
+		if err != nil {
+			returnwitherror(w, 400, "invalid cursor")
+			return
+		}
+	}
+	limit := params.PageSize
+	params.PageSize++
+	rows, err := apiconfig.dbQueries.SearchChirps(r.Context(), params)
+	if err != nil {
+		returnwitherror(w, 500, "Could not search chirps")
+		return
+	}
+	resp := chirpsPage{Chirps: []chirpsOutput{}}
+	if len(rows) > int(limit) {
+		rows = rows[:limit]
+		cursor := paging.EncodeOffset(int(params.PageOffset) + int(limit))
+		resp.NextCursor = &cursor
+	}
+	chirps := make([]database.Chirp, 0, len(rows))
+	for _, v := range rows {
+		chirps = append(chirps, database.Chirp{ID: v.ID, CreatedAt: v.CreatedAt, UpdatedAt: v.UpdatedAt, Body: v.Body, UserID: v.UserID, ParentID: v.ParentID, Kind: v.Kind, OriginalID: v.OriginalID, HiddenAt: v.HiddenAt})
+	}
+	extras, err := loadChirpExtras(r, chirps)
+	if err != nil {
+		returnwitherror(w, 500, "Could not load chirps")
+		return
+	}
+	for _, v := range chirps {
+		resp.Chirps = append(resp.Chirps, extras.output(v))
+	}
+	respjson, err := json.Marshal(resp)
+	if err != nil {
+		returnwitherror(w, 500, "Could Not Marshall Chirps")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(respjson)
+}
+
+func getchirps(w http.ResponseWriter, code int, r *http.Request, authorID string, page pageParams) {
+	var chirps []database.Chirp
+	var err error
+	if authorID != "" {
+		suuid, err := uuid.Parse(authorID)
+		if err != nil {
+			returnwitherror(w, 400, "Could not find UserID")
+			return
+		}
+		if page.Ascending {
+			chirps, err = apiconfig.dbQueries.GetChirpsByAuthor(r.Context(), database.GetChirpsByAuthorParams{UserID: suuid, CursorCreatedAt: page.CursorCreatedAt, CursorID: page.CursorID, ViewerID: optionalViewer(r), PageSize: page.Limit + 1})
+		} else {
+			chirps, err = apiconfig.dbQueries.GetChirpsByAuthorDesc(r.Context(), database.GetChirpsByAuthorDescParams{UserID: suuid, CursorCreatedAt: page.CursorCreatedAt, CursorID: page.CursorID, ViewerID: optionalViewer(r), PageSize: page.Limit + 1})
+		}
+		if err != nil {
+			returnwitherror(w, 500, "Could not get chirps")
+			return
+		}
+	} else {
+		if page.Ascending {
+			chirps, err = apiconfig.dbQueries.GetChirps(r.Context(), database.GetChirpsParams{CursorCreatedAt: page.CursorCreatedAt, CursorID: page.CursorID, ViewerID: optionalViewer(r), PageSize: page.Limit + 1})
+		} else {
+			chirps, err = apiconfig.dbQueries.GetChirpsDesc(r.Context(), database.GetChirpsDescParams{CursorCreatedAt: page.CursorCreatedAt, CursorID: page.CursorID, ViewerID: optionalViewer(r), PageSize: page.Limit + 1})
+		}
+		if err != nil {
+			returnwitherror(w, 500, "Could not get chirps")
+			return
+		}
+	}
+	writeChirpsPage(w, code, chirps, page, r)
+}
+
+// editChirp stores the current body as a revision and applies the new one in a
+// single transaction so history never drifts from the live chirp.
+func editChirp(w http.ResponseWriter, code int, chirp database.Chirp, body string, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	tx, err := apiconfig.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		returnwitherror(w, 500, "Could not edit chirp")
+		return
+	}
+	defer tx.Rollback()
+	qtx := apiconfig.dbQueries.WithTx(tx)
+	// The revision is built from the row as locked here, not the one the
+	// handler read, so concurrent edits each keep the body they replaced.
+	current, err := qtx.GetChirpForUpdate(r.Context(), chirp.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		returnwitherror(w, 404, "Could not get chirps")
+		return
+	} else if err != nil {
+		returnwitherror(w, 500, "Could not edit chirp")
+		return
+	}
+	_, err = qtx.CreateChirpRevision(r.Context(), database.CreateChirpRevisionParams{ChirpID: current.ID, Body: current.Body, CreatedAt: current.UpdatedAt})
+	if err != nil {
+		returnwitherror(w, 500, "Could not save chirp revision")
+		return
+	}
+	updated, err := qtx.UpdateChirp(r.Context(), database.UpdateChirpParams{Body: apiconfig.profanity.Clean(body), ID: chirp.ID})
+	if err != nil {
+		returnwitherror(w, 500, "Could not edit chirp")
+		return
+	}
+	err = qtx.ClearChirpHashtags(r.Context(), chirp.ID)
+	if err != nil {
+		returnwitherror(w, 500, "Could not save hashtags")
+		return
+	}
+	err = saveHashtags(r.Context(), qtx, updated)
+	if err != nil {
+		returnwitherror(w, 500, "Could not save hashtags")
+		return
+	}
+	err = qtx.ClearChirpMentions(r.Context(), chirp.ID)
+	if err != nil {
+		returnwitherror(w, 500, "Could not save mentions")
+		return
+	}
+	err = saveMentions(r.Context(), qtx, updated)
+	if err != nil {
+		returnwitherror(w, 500, "Could not save mentions")
+		return
+	}
+	if err = tx.Commit(); err != nil {
+		returnwitherror(w, 500, "Could not edit chirp")
+		return
+	}
+	extras, err := loadChirpExtras(r, []database.Chirp{updated})
+	if err != nil {
+		returnwitherror(w, 500, "Could not load chirps")
+		return
+	}
+	chirpresp := extras.output(updated)
+	rspjson, err := json.Marshal(chirpresp)
+	if err != nil {
+		returnwitherror(w, 500, "Could not marshall chirpresp")
+		return
+	}
+	w.WriteHeader(code)
+	w.Write(rspjson)
+}
+
+// deleteChirp removes pure rechirps together with the chirp they repost, since
+// they have nothing left to show. Quotes survive and render original_deleted.
+func deleteChirp(w http.ResponseWriter, code int, chirpID uuid.UUID, r *http.Request) {
+	tx, err := apiconfig.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		returnwitherror(w, 500, "Could not delete chirp")
+		return
+	}
+	defer tx.Rollback()
+	qtx := apiconfig.dbQueries.WithTx(tx)
+	err = qtx.DeleteRechirps(r.Context(), uuid.NullUUID{UUID: chirpID, Valid: true})
+	if err != nil {
+		returnwitherror(w, 500, "Could not delete rechirps")
+		return
+	}
+	err = qtx.DeleteChirp(r.Context(), chirpID)
+	if err != nil {
+		returnwitherror(w, 500, "Could not delete chirp")
+		return
+	}
+	if err = tx.Commit(); err != nil {
+		returnwitherror(w, 500, "Could not delete chirp")
+		return
+	}
+	w.WriteHeader(code)
+}
+
+// writeReportsPage embeds the reported chirp in each open report, loading all of
+// them in one query, and pages like writeChirpsPage.
+func writeReportsPage(w http.ResponseWriter, code int, reports []database.ChirpReport, page pageParams, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	resp := reportsPage{Reports: []reportOutput{}}
+	if len(reports) > int(page.Limit) {
+		reports = reports[:page.Limit]
+		last := reports[len(reports)-1]
+		cursor := paging.EncodeCursor(last.CreatedAt, last.ID)
+		resp.NextCursor = &cursor
+	}
+	chirpIDs := make([]uuid.UUID, 0, len(reports))
+	for _, v := range reports {
+		chirpIDs = append(chirpIDs, v.ChirpID)
+	}
+	chirps := []database.Chirp{}
+	if len(chirpIDs) > 0 {
+		var err error
+		chirps, err = apiconfig.dbQueries.GetChirpsByIDs(r.Context(), chirpIDs)
+		if err != nil {
+			returnwitherror(w, 500, "Could not load chirps")
+			return
+		}
+	}
+	extras, err := loadChirpExtras(r, chirps)
+	if err != nil {
+		returnwitherror(w, 500, "Could not load chirps")
+		return
+	}
+	byID := map[uuid.UUID]chirpsOutput{}
+	for _, v := range chirps {
+		byID[v.ID] = extras.output(v)
+	}
+	for _, v := range reports {
+		report := reportOutput{ID: v.ID, ChirpID: v.ChirpID, ReporterID: v.ReporterID, Reason: v.Reason, CreatedAt: v.CreatedAt}
+		if chirp, ok := byID[v.ChirpID]; ok {
+			report.Chirp = &chirp
+		}
+		resp.Reports = append(resp.Reports, report)
+	}
+	respjson, err := json.Marshal(resp)
+	if err != nil {
+		returnwitherror(w, 500, "Could Not Marshall Reports")
+		return
+	}
+	w.WriteHeader(code)
+	w.Write(respjson)
+}
+
+// hideChirp hides the chirp and closes its open reports in one transaction, so
+// the queue never lists a chirp that has already been acted on.
+func hideChirp(w http.ResponseWriter, code int, chirpID uuid.UUID, r *http.Request) {
+	tx, err := apiconfig.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		returnwitherror(w, 500, "Could not hide chirp")
+		return
+	}
+	defer tx.Rollback()
+	qtx := apiconfig.dbQueries.WithTx(tx)
+	chirp, err := qtx.HideChirp(r.Context(), chirpID)
+	if err != nil {
+		returnwitherror(w, 404, "Could not get chirps")
+		return
+	}
+	_, err = qtx.ResolveReports(r.Context(), database.ResolveReportsParams{Resolution: sql.NullString{String: reportHidden, Valid: true}, ChirpID: chirpID})
+	if err != nil {
+		returnwitherror(w, 500, "Could not resolve reports")
+		return
+	}
+	if err = tx.Commit(); err != nil {
+		returnwitherror(w, 500, "Could not hide chirp")
+		return
+	}
+	chirpjson, err := json.Marshal(chirpToOutput(chirp))
+	if err != nil {
+		returnwitherror(w, 500, "Could not marshall chirp")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(chirpjson)
+}
+
+// clientIP is the address the request came from, without the port.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// userAgent is the User-Agent header made safe to store in a TEXT column:
+// valid UTF-8 without NUL bytes, cut to at most maxUserAgentLength bytes on a
+// rune boundary.
+func userAgent(r *http.Request) string {
+	agent := strings.ToValidUTF8(r.UserAgent(), "\uFFFD")
+	agent = strings.ReplaceAll(agent, "\x00", "")
+	if len(agent) > maxUserAgentLength {
+		cut := maxUserAgentLength
+		for !utf8.RuneStart(agent[cut]) {
+			cut--
+		}
+		agent = agent[:cut]
+	}
+	return agent
+}
+
+// findRefreshToken looks a refresh token up by its prefix and checks the rest
+// against the stored digest, so the database never needs the token itself.
+// Expired tokens are never found, revoked ones are so callers can spot reuse.
+func findRefreshToken(ctx context.Context, q *database.Queries, token string) (database.RefreshToken, error) {
+	candidates, err := q.QueryRefreshToken(ctx, auth.RefreshTokenPrefix(token))
+	if err != nil {
+		return database.RefreshToken{}, err
+	}
+	for _, v := range candidates {
+		if auth.CheckRefreshToken(token, v.TokenHash) {
+			return v, nil
+		}
+	}
+	return database.RefreshToken{}, sql.ErrNoRows
+}
+
+// errInvalidRefreshToken covers every refresh token that can not be used:
+// unknown, expired, already used, or presented by the wrong client.
+var errInvalidRefreshToken = errors.New("invalid refresh token")
+
+// exchangeRefreshToken revokes token and saves a new refresh token in the same
+// family, with the same client and scopes. A token is only good for one
+// refresh, so seeing a revoked one again means it was copied: the whole family
+// is revoked and whoever holds it has to log in again. The exception is a
+// token rotated in the last few seconds while its family is still active,
+// which is what two tabs refreshing at once look like; it gets one more token
+// in the family, once. Tokens only work for the client they were issued to;
+// clientID is null for logins.
+func exchangeRefreshToken(r *http.Request, token string, clientID uuid.NullUUID) (database.RefreshToken, string, error) {
+	tx, err := apiconfig.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		return database.RefreshToken{}, "", err
+	}
+	defer tx.Rollback()
+	qtx := apiconfig.dbQueries.WithTx(tx)
+	old, err := findRefreshToken(r.Context(), qtx, token)
+	if errors.Is(err, sql.ErrNoRows) || ((err == nil) && (old.ClientID != clientID)) {
+		return database.RefreshToken{}, "", errInvalidRefreshToken
+	}
+	if err != nil {
+		return database.RefreshToken{}, "", err
+	}
+	if !old.RevokedAt.Valid {
+		// Two refreshes racing on the same token also end up here: only
+		// one of them gets to revoke it.
+		_, err = qtx.RevokeActiveRefreshToken(r.Context(), old.ID)
+		if errors.Is(err, sql.ErrNoRows) {
+			old.RevokedAt = sql.NullTime{Time: time.Now(), Valid: true}
+		} else if err != nil {
+			return database.RefreshToken{}, "", err
+		}
+	}
+	if old.RevokedAt.Valid {
+		// The grace is claimed with an update, so each rotated token is
+		// traded at most once more and a replay after that is reuse.
+		graced, err := qtx.UseRefreshTokenGrace(r.Context(), old.ID)
+		if err != nil {
+			return database.RefreshToken{}, "", err
+		}
+		if graced == 0 {
+			revoked, err := qtx.RevokeRefreshTokenFamily(r.Context(), old.FamilyID)
+			if err != nil {
+				return database.RefreshToken{}, "", err
+			}
+			if err = tx.Commit(); err != nil {
+				return database.RefreshToken{}, "", err
+			}
+			log.Printf("refresh token reuse for user %v, revoked %d tokens in family %v", old.UserID, revoked, old.FamilyID)
+			return database.RefreshToken{}, "", errInvalidRefreshToken
+		}
+	}
+	refreshToken, err := auth.MakeRefreshToken()
+	if err != nil {
+		return database.RefreshToken{}, "", err
+	}
+	_, err = qtx.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{TokenPrefix: auth.RefreshTokenPrefix(refreshToken), TokenHash: auth.HashRefreshToken(refreshToken), UserID: old.UserID, FamilyID: old.FamilyID, UserAgent: userAgent(r), Ip: clientIP(r), ClientID: old.ClientID, Scopes: append([]string{}, old.Scopes...)})
+	if err != nil {
+		return database.RefreshToken{}, "", err
+	}
+	if err = tx.Commit(); err != nil {
+		return database.RefreshToken{}, "", err
+	}
+	return old, refreshToken, nil
+}
+
+// rotateRefreshToken trades a login's refresh token for a new access token
+// and a new refresh token.
+func rotateRefreshToken(w http.ResponseWriter, code int, token string, r *http.Request) {
+	old, refreshToken, err := exchangeRefreshToken(r, token, uuid.NullUUID{})
+	if errors.Is(err, errInvalidRefreshToken) {
+		returnwitherror(w, 401, "Could not find token / is expired")
+		return
+	}
+	if err != nil {
+		returnwitherror(w, 500, "Could not refresh token")
+		return
+	}
+	user, err := apiconfig.dbQueries.UserByID(r.Context(), old.UserID)
+	if err != nil {
+		returnwitherror(w, 401, "Could not find user")
+		return
+	}
+	acctoken, err := auth.MakeJWT(user.ID, user.Role, apiconfig.jwt_config)
+	if err != nil {
+		returnwitherror(w, 500, "Could not make jwt")
+		return
+	}
+	accjson, err := json.Marshal(tokenstruct{Token: acctoken, Refresh_token: &refreshToken})
+	if err != nil {
+		returnwitherror(w, 500, "Could not marshall json")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(accjson)
+}
+
+func oauthClientToOutput(client database.OauthClient) oauthClientOutput {
+	return oauthClientOutput{ClientID: client.ID, Name: client.Name, RedirectURIs: client.RedirectUris, Scopes: client.Scopes, Public: client.SecretHash == nil, CreatedAt: client.CreatedAt}
+}
+
+// returnOAuthError answers in the error format of RFC 6749 section 5.2, which
+// OAuth client libraries expect from the token endpoint.
+func returnOAuthError(w http.ResponseWriter, code int, errcode, description string) {
+	errjson, _ := json.Marshal(oauthErrordata{Error: errcode, ErrorDescription: description})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(errjson)
+}
+
+// authenticateClient identifies the client calling the token endpoint, from
+// HTTP Basic credentials or the client_id and client_secret form fields.
+// Public clients have no secret and only send their client_id; PKCE is what
+// protects their codes. It answers invalid_client itself.
+func authenticateClient(w http.ResponseWriter, r *http.Request) (database.OauthClient, bool) {
+	id, secret, basic := r.BasicAuth()
+	if !basic {
+		id, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	clientid, err := uuid.Parse(id)
+	if err == nil {
+		client, err := apiconfig.dbQueries.GetOAuthClient(r.Context(), clientid)
+		if err == nil {
+			if (client.SecretHash == nil) || auth.CheckRefreshToken(secret, client.SecretHash) {
+				return client, true
+			}
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			returnOAuthError(w, 500, "server_error", "Could not get client")
+			return database.OauthClient{}, false
+		}
+	}
+	w.Header().Set("WWW-Authenticate", `Basic realm="chirpy"`)
+	returnOAuthError(w, 401, "invalid_client", "Client authentication failed")
+	return database.OauthClient{}, false
+}
+
+// checkAuthorizeRequest validates an authorization request and returns the
+// client, the redirect uri to send the user back to and the scopes asked for.
+// The redirect uri has to match a registered one exactly and can only be left
+// out when the client registered a single one. Every problem is answered
+// with a 400 rather than a redirect, so a bad request can never bounce the
+// user to an address the client did not register.
+func checkAuthorizeRequest(w http.ResponseWriter, r *http.Request, params authorizeInput) (database.OauthClient, string, []string, bool) {
+	clientid, err := uuid.Parse(params.ClientID)
+	if err != nil {
+		returnwitherror(w, 400, "Invalid client_id")
+		return database.OauthClient{}, "", nil, false
+	}
+	client, err := apiconfig.dbQueries.GetOAuthClient(r.Context(), clientid)
+	if errors.Is(err, sql.ErrNoRows) {
+		returnwitherror(w, 400, "Unknown client")
+		return database.OauthClient{}, "", nil, false
+	}
+	if err != nil {
+		returnwitherror(w, 500, "Could not get client")
+		return database.OauthClient{}, "", nil, false
+	}
+	redirectURI := params.RedirectURI
+	if (redirectURI == "") && (len(client.RedirectUris) == 1) {
+		redirectURI = client.RedirectUris[0]
+	}
+	if !slices.Contains(client.RedirectUris, redirectURI) {
+		returnwitherror(w, 400, "redirect_uri is not registered for this client")
+		return database.OauthClient{}, "", nil, false
+	}
+	if params.ResponseType != "code" {
+		returnwitherror(w, 400, "response_type must be code")
+		return database.OauthClient{}, "", nil, false
+	}
+	if (params.CodeChallengeMethod != "S256") || !auth.ValidPKCEChallenge(params.CodeChallenge) {
+		returnwitherror(w, 400, "A code_challenge with code_challenge_method S256 is required")
+		return database.OauthClient{}, "", nil, false
+	}
+	scopes, err := auth.ParseScope(params.Scope, client.Scopes)
+	if err != nil {
+		returnwitherror(w, 400, err.Error())
+		return database.OauthClient{}, "", nil, false
+	}
+	return client, redirectURI, scopes, true
+}
+
+// withQuery adds values to the query of a registered redirect uri, keeping
+// any query it already has.
+func withQuery(redirectURI string, values url.Values) (string, error) {
+	u, err := url.Parse(redirectURI)
+	if err != nil {
+		return "", err
+	}
+	query := u.Query()
+	for k, v := range values {
+		query[k] = v
+	}
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// writeOAuthToken answers the token endpoint with a new access token for the
+// client and the refresh token that was saved for it.
+func writeOAuthToken(w http.ResponseWriter, userID, clientID uuid.UUID, scopes []string, refreshToken string) {
+	acctoken, err := auth.MakeClientJWT(userID, clientID, scopes, apiconfig.jwt_config)
+	if err != nil {
+		returnOAuthError(w, 500, "server_error", "Could not make jwt")
+		return
+	}
+	respjson, err := json.Marshal(oauthTokenOutput{AccessToken: acctoken, TokenType: "Bearer", ExpiresIn: int(apiconfig.jwt_config.ClientTokenLifetime.Seconds()), RefreshToken: refreshToken, Scope: strings.Join(scopes, " ")})
+	if err != nil {
+		returnOAuthError(w, 500, "server_error", "Could not marshall token")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	w.Write(respjson)
+}
+
+// exchangeAuthorizationCode saves the first refresh token of a grant. A code
+// is good for one exchange; seeing it again means it leaked, so everything
+// issued from it is revoked (RFC 6749 section 4.1.2). The tokens of a grant
+// share the code's id as their family.
+func exchangeAuthorizationCode(w http.ResponseWriter, r *http.Request, client database.OauthClient) {
+	tx, err := apiconfig.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		returnOAuthError(w, 500, "server_error", "Could not start transaction")
+		return
+	}
+	defer tx.Rollback()
+	qtx := apiconfig.dbQueries.WithTx(tx)
+	code, err := qtx.GetAuthorizationCode(r.Context(), auth.HashToken(r.PostForm.Get("code")))
+	if errors.Is(err, sql.ErrNoRows) || ((err == nil) && (code.ClientID != client.ID)) {
+		returnOAuthError(w, 400, "invalid_grant", "Unknown authorization code")
+		return
+	}
+	if err != nil {
+		returnOAuthError(w, 500, "server_error", "Could not get authorization code")
+		return
+	}
+	used, err := qtx.UseAuthorizationCode(r.Context(), code.ID)
+	if err != nil {
+		returnOAuthError(w, 500, "server_error", "Could not use authorization code")
+		return
+	}
+	if used == 0 {
+		if code.UsedAt.Valid {
+			revoked, err := qtx.RevokeRefreshTokenFamily(r.Context(), code.ID)
+			if err != nil {
+				returnOAuthError(w, 500, "server_error", "Could not revoke tokens")
+				return
+			}
+			if err = tx.Commit(); err != nil {
+				returnOAuthError(w, 500, "server_error", "Could not commit transaction")
+				return
+			}
+			log.Printf("authorization code reuse by client %v, revoked %d tokens", client.ID, revoked)
+		}
+		returnOAuthError(w, 400, "invalid_grant", "Authorization code is expired or already used")
+		return
+	}
+	// A wrong redirect_uri or verifier rolls back, so the code stays usable
+	// by whoever holds the verifier.
+	if r.PostForm.Get("redirect_uri") != code.RedirectUri {
+		returnOAuthError(w, 400, "invalid_grant", "redirect_uri does not match the authorization request")
+		return
+	}
+	if !auth.VerifyPKCE(r.PostForm.Get("code_verifier"), code.CodeChallenge) {
+		returnOAuthError(w, 400, "invalid_grant", "code_verifier does not match the code_challenge")
+		return
+	}
+	refreshToken, err := auth.MakeRefreshToken()
+	if err != nil {
+		returnOAuthError(w, 500, "server_error", "Could not make refresh token")
+		return
+	}
+	_, err = qtx.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{TokenPrefix: auth.RefreshTokenPrefix(refreshToken), TokenHash: auth.HashRefreshToken(refreshToken), UserID: code.UserID, FamilyID: code.ID, UserAgent: userAgent(r), Ip: clientIP(r), ClientID: uuid.NullUUID{UUID: client.ID, Valid: true}, Scopes: code.Scopes})
+	if err != nil {
+		returnOAuthError(w, 500, "server_error", "Could not save refresh token")
+		return
+	}
+	if err = tx.Commit(); err != nil {
+		returnOAuthError(w, 500, "server_error", "Could not commit transaction")
+		return
+	}
+	writeOAuthToken(w, code.UserID, client.ID, code.Scopes, refreshToken)
+}
+
+// checkSecondFactor accepts either a TOTP code or an unused recovery code. TOTP
+// codes are single use too: the matched step is recorded and only later steps
+// are accepted afterwards.
+func checkSecondFactor(ctx context.Context, q *database.Queries, totp database.UserTotp, params twoFactorInput) (bool, error) {
+	if params.Code != "" {
+		counter, ok := auth.ValidateTOTP(totp.Secret, params.Code, time.Now())
+		if !ok {
+			return false, nil
+		}
+		used, err := q.UseTOTPCounter(ctx, database.UseTOTPCounterParams{UserID: totp.UserID, LastCounter: counter})
+		return used == 1, err
+	}
+	if params.RecoveryCode != "" {
+		used, err := q.UseRecoveryCode(ctx, database.UseRecoveryCodeParams{UserID: totp.UserID, CodeHash: auth.HashRecoveryCode(params.RecoveryCode)})
+		return used == 1, err
+	}
+	return false, nil
+}
+
+// startCodeAttempt counts a two-factor code attempt against the user before
+// the code is checked, for the endpoints a logged in user confirms with a
+// code. It answers 429 with Retry-After, and returns false, while the user is
+// backing off. The count is cleared with resetCodeAttempts once a code is
+// right.
+func startCodeAttempt(w http.ResponseWriter, r *http.Request, userID uuid.UUID) bool {
+	res, err := apiconfig.totp_throttle.Attempt(r.Context(), userID.String())
+	if err != nil {
+		returnwitherror(w, 500, "Could not check code attempts")
+		return false
+	}
+	if !res.Allowed {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(res.RetryAfter.Seconds()))))
+		returnwitherror(w, 429, "Too many wrong codes, try again later")
+		return false
+	}
+	if res.Locked {
+		log.Printf("two-factor codes locked for user %v after %d attempts, for %v", userID, res.Failures, res.RetryAfter)
+	}
+	return true
+}
+
+func resetCodeAttempts(ctx context.Context, userID uuid.UUID) {
+	err := apiconfig.totp_throttle.Reset(ctx, userID.String())
+	if err != nil {
+		log.Printf("could not reset code throttle: %v", err)
+	}
+}
+
+// issueRecoveryCodes replaces the user's recovery codes with a fresh set. Only
+// digests are stored, so this is the one time the codes can be shown.
+func issueRecoveryCodes(ctx context.Context, q *database.Queries, userID uuid.UUID) ([]string, error) {
+	codes, err := auth.GenerateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	err = q.DeleteRecoveryCodes(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, code := range codes {
+		err = q.CreateRecoveryCode(ctx, database.CreateRecoveryCodeParams{UserID: userID, CodeHash: auth.HashRecoveryCode(code)})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return codes, nil
+}
+
+func writeRecoveryCodes(w http.ResponseWriter, code int, codes []string) {
+	codesjson, err := json.Marshal(recoveryCodesOutput{RecoveryCodes: codes})
+	if err != nil {
+		returnwitherror(w, 500, "Could not marshall recovery codes")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	w.Write(codesjson)
+}
+
+// startLoginChallenge is what POST /api/login returns instead of tokens when
+// the user has two-factor authentication on. The challenge token proves the
+// password was right and is exchanged with a code at /api/login/2fa.
+func startLoginChallenge(w http.ResponseWriter, code int, user database.User, r *http.Request) {
+	token, err := auth.MakeRefreshToken()
+	if err != nil {
+		returnwitherror(w, 500, "Could not make challenge token")
+		return
+	}
+	challenge, err := apiconfig.dbQueries.CreateLoginChallenge(r.Context(), database.CreateLoginChallengeParams{TokenHash: auth.HashToken(token), UserID: user.ID})
+	if err != nil {
+		returnwitherror(w, 500, "Could not save challenge")
+		return
+	}
+	challengejson, err := json.Marshal(loginChallengeOutput{TwoFactorRequired: true, ChallengeToken: token, ExpiresAt: challenge.ExpiresAt})
+	if err != nil {
+		returnwitherror(w, 500, "Could not marshall challenge")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(challengejson)
+}
+
+// startLoginAttempt counts a login attempt against both the email and the IP
+// before any password is checked, so concurrent tries can not slip past the
+// throttle together. It answers 429 with Retry-After, and returns false, while
+// either is backing off. A try that succeeds is given back with
+// refundLoginAttempt.
+func startLoginAttempt(w http.ResponseWriter, r *http.Request, email, ip string) bool {
+	emailRes, err := apiconfig.login_email_throttle.Attempt(r.Context(), email)
+	if err != nil {
+		returnwitherror(w, 500, "Could not check login attempts")
+		return false
+	}
+	if !emailRes.Allowed {
+		loginThrottled(w, emailRes.RetryAfter)
+		return false
+	}
+	ipRes, err := apiconfig.login_ip_throttle.Attempt(r.Context(), ip)
+	if err != nil {
+		returnwitherror(w, 500, "Could not check login attempts")
+		return false
+	}
+	if !ipRes.Allowed {
+		// The email was counted already, but this try never got to check
+		// its password.
+		err = apiconfig.login_email_throttle.Refund(r.Context(), email)
+		if err != nil {
+			log.Printf("could not refund login attempt: %v", err)
+		}
+		loginThrottled(w, ipRes.RetryAfter)
+		return false
+	}
+	if emailRes.Locked {
+		log.Printf("login locked for email %q after %d attempts, for %v", email, emailRes.Failures, emailRes.RetryAfter)
+	}
+	if ipRes.Locked {
+		log.Printf("login locked for ip %v after %d attempts, for %v", ip, ipRes.Failures, ipRes.RetryAfter)
+	}
+	return true
+}
+
+func loginThrottled(w http.ResponseWriter, wait time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	returnwitherror(w, 429, "Too many failed login attempts, try again later")
+}
+
+// refundLoginAttempt gives back an attempt counted by startLoginAttempt once
+// it turned out to be right.
+func refundLoginAttempt(ctx context.Context, email, ip string) {
+	err := apiconfig.login_email_throttle.Refund(ctx, email)
+	if err != nil {
+		log.Printf("could not refund login attempt: %v", err)
+	}
+	err = apiconfig.login_ip_throttle.Refund(ctx, ip)
+	if err != nil {
+		log.Printf("could not refund login attempt: %v", err)
+	}
+}
+
+// resetLoginThrottle forgets the failures of email once a login is complete.
+// Only the account is forgiven; an IP that found one working password keeps
+// the failures it racked up on others.
+func resetLoginThrottle(ctx context.Context, email string) {
+	err := apiconfig.login_email_throttle.Reset(ctx, email)
+	if err != nil {
+		log.Printf("could not reset login throttle: %v", err)
+	}
+}
+
+// sendMail delivers msg in the background. It runs after the response is
+// written, so a slow mail server never holds up the request and the timing
+// does not give away whether an email belongs to an account.
+func sendMail(userID uuid.UUID, msg mail.Message) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	err := apiconfig.mailer.Send(ctx, msg)
+	if err != nil {
+		log.Printf("could not send %q to user %v: %v", msg.Subject, userID, err)
+	}
+}
+
+// startResetAttempt counts a password reset request against both the email
+// and the IP. It answers 429 with Retry-After, and returns false, while either
+// is backing off.
+func startResetAttempt(w http.ResponseWriter, r *http.Request, email, ip string) bool {
+	emailRes, err := apiconfig.reset_email_throttle.Attempt(r.Context(), email)
+	if err != nil {
+		returnwitherror(w, 500, "Could not check reset requests")
+		return false
+	}
+	wait := emailRes.RetryAfter
+	if emailRes.Allowed {
+		ipRes, err := apiconfig.reset_ip_throttle.Attempt(r.Context(), ip)
+		if err != nil {
+			returnwitherror(w, 500, "Could not check reset requests")
+			return false
+		}
+		if ipRes.Allowed {
+			return true
+		}
+		// The email was counted already, but no reset goes out for it.
+		err = apiconfig.reset_email_throttle.Refund(r.Context(), email)
+		if err != nil {
+			log.Printf("could not refund reset request: %v", err)
+		}
+		wait = ipRes.RetryAfter
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	returnwitherror(w, 429, "Too many password reset requests, try again later")
+	return false
+}
+
+// startPasswordReset looks up email and mails its account a reset token. It
+// runs after the response is written, so whether the email has an account
+// does not change how long the request takes.
+func startPasswordReset(email string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	user, err := apiconfig.dbQueries.UserByEmail(ctx, email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return
+	} else if err != nil {
+		log.Printf("could not look up password reset email: %v", err)
+		return
+	}
+	token, err := auth.MakeRefreshToken()
+	if err != nil {
+		log.Printf("could not make reset token for user %v: %v", user.ID, err)
+		return
+	}
+	_, err = apiconfig.dbQueries.CreatePasswordResetToken(ctx, database.CreatePasswordResetTokenParams{TokenHash: auth.HashToken(token), UserID: user.ID})
+	if err != nil {
+		log.Printf("could not save reset token for user %v: %v", user.ID, err)
+		return
+	}
+	sendPasswordReset(user, token)
+}
+
+func sendPasswordReset(user database.User, token string) {
+	sendMail(user.ID, mail.Message{
+		To:      user.Email,
+		Subject: "Reset your Chirpy password",
+		Body: "Someone asked to reset the password of your Chirpy account.\n\n" +
+			"Reset token: " + token + "\n\n" +
+			"Send it with your new password to POST /api/password-reset/confirm within an hour. " +
+			"If this was not you, you can ignore this email.\n",
+	})
+}
+
+// startEmailVerification mails a link confirming email belongs to the user.
+// For a new account email is the one it signed up with, for an email change
+// it is the new address, which only replaces the old one once confirmed.
+func startEmailVerification(ctx context.Context, userID uuid.UUID, email string) error {
+	msg, err := createEmailVerification(ctx, apiconfig.dbQueries, userID, email)
+	if err != nil {
+		return err
+	}
+	go sendMail(userID, msg)
+	return nil
+}
+
+// createEmailVerification saves a verification token with q and returns the
+// email carrying its link. Inside a transaction send it only after committing.
+func createEmailVerification(ctx context.Context, q *database.Queries, userID uuid.UUID, email string) (mail.Message, error) {
+	token, err := auth.MakeRefreshToken()
+	if err != nil {
+		return mail.Message{}, err
+	}
+	_, err = q.CreateEmailVerificationToken(ctx, database.CreateEmailVerificationTokenParams{TokenHash: auth.HashToken(token), UserID: userID, Email: email})
+	if err != nil {
+		return mail.Message{}, err
+	}
+	link := apiconfig.base_url + "/api/users/verify-email?token=" + url.QueryEscape(token)
+	return mail.Message{
+		To:      email,
+		Subject: "Confirm your Chirpy email",
+		Body: "Open this link within 24 hours and click confirm to verify this email address for your Chirpy account:\n\n" +
+			link + "\n\n" +
+			"If you did not sign up or change your email, you can ignore this email.\n",
+	}, nil
+}
+
+// verifyEmailPage is served for the link in the verification email. It reads
+// the token from the link and only sends it when the user clicks confirm.
+const verifyEmailPage = `<html>
+  <body>
+    <h1>Confirm your Chirpy email</h1>
+    <button id="confirm">Confirm email</button>
+    <p id="result"></p>
+    <script>
+      document.getElementById("confirm").addEventListener("click", async () => {
+        const token = new URLSearchParams(window.location.search).get("token") || "";
+        const res = await fetch("/api/users/verify-email", {
+          method: "POST",
+          headers: {"Content-Type": "application/json"},
+          body: JSON.stringify({token: token}),
+        });
+        document.getElementById("result").textContent = res.ok ? "Your email is confirmed." : (await res.json()).error;
+      });
+    </script>
+  </body>
+</html>
+`
+
+// validateEmail accepts a bare address like walt@example.com. Display names
+// and anything net/mail would have to rewrite are refused.
+func validateEmail(email string) error {
+	if len(email) > maxEmailLength {
+		return fmt.Errorf("email must be at most %d characters", maxEmailLength)
+	}
+	addr, err := netmail.ParseAddress(email)
+	if (err != nil) || (addr.Address != email) || !strings.Contains(addr.Address[strings.LastIndex(addr.Address, "@"):], ".") {
+		return errors.New("email is not a valid address")
+	}
+	return nil
+}
+
+func userToOutput(user database.User) User {
+	userstruct := User{ID: user.ID, CreatedAt: user.CreatedAt, UpdatedAt: user.UpdatedAt, Email: user.Email, Is_chirpy_red: user.IsChirpyRed, Role: user.Role, Email_verified: user.EmailVerifiedAt.Valid}
+	if user.Handle.Valid {
+		userstruct.Handle = &user.Handle.String
+	}
+	return userstruct
+}
+
+// buildThread nests the flat descendant list under the chirp it was loaded for.
+// Descendants come back oldest first, so every parent is seen before its replies.
+func buildThread(chirp database.Chirp, descendants []database.Chirp, extras chirpExtras) *threadNode {
+	root := &threadNode{chirpsOutput: extras.output(chirp), Replies: []*threadNode{}}
+	nodes := map[uuid.UUID]*threadNode{chirp.ID: root}
+	for _, v := range descendants {
+		// A hidden reply takes its subtree with it: its children never find a
+		// parent node to attach to.
+		if !chirpVisible(v, extras.viewer) {
+			continue
+		}
+		node := &threadNode{chirpsOutput: extras.output(v), Replies: []*threadNode{}}
+		nodes[v.ID] = node
+		if parent, ok := nodes[v.ParentID.UUID]; ok {
+			parent.Replies = append(parent.Replies, node)
+		}
+	}
+	return root
+}
+
+// writeFollowsPage works like writeChirpsPage for follower/following lists.
+func writeFollowsPage(w http.ResponseWriter, code int, follows []followOutput, page pageParams) {
+	w.Header().Set("Content-Type", "application/json")
+	resp := followsPage{Users: []followOutput{}}
+	if len(follows) > int(page.Limit) {
+		follows = follows[:page.Limit]
+		last := follows[len(follows)-1]
+		cursor := paging.EncodeCursor(last.FollowedAt, last.UserID)
+		resp.NextCursor = &cursor
+	}
+	resp.Users = append(resp.Users, follows...)
+	respjson, err := json.Marshal(resp)
+	if err != nil {
+		returnwitherror(w, 500, "Could Not Marshall Users")
+		return
+	}
+	w.WriteHeader(code)
+	w.Write(respjson)
+}
+
+func returnUser(w http.ResponseWriter, code int, userquery database.User, r *http.Request) {
+	token, err := auth.MakeJWT(userquery.ID, userquery.Role, apiconfig.jwt_config)
+	if err != nil {
+		returnwitherror(w, 500, "Could not make jwt")
+		return
+	}
+	refreshToken, err := auth.MakeRefreshToken()
+	if err != nil {
+		returnwitherror(w, 500, "Could not make refresh token")
+		return
+	}
+	userstruct := userToOutput(userquery)
+	userstruct.Token = &token
+	userstruct.Refresh_token = &refreshToken
+	_, err = apiconfig.dbQueries.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{TokenPrefix: auth.RefreshTokenPrefix(refreshToken), TokenHash: auth.HashRefreshToken(refreshToken), UserID: userstruct.ID, FamilyID: uuid.New(), UserAgent: userAgent(r), Ip: clientIP(r), Scopes: []string{}})
+	if err != nil {
+		returnwitherror(w, 500, "Could not save refresh token")
+		return
+	}
+	userjson, err := json.Marshal(userstruct)
+	if err != nil {
+		returnwitherror(w, 500, "Could not marshall userstruct")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(userjson)
+}
+
+// loadPasswordPolicy starts from auth.DefaultPasswordPolicy and applies
+// PASSWORD_MIN_LENGTH, PASSWORD_MAX_LENGTH and PASSWORD_MIN_CLASSES, plus the
+// leaked password digests in BREACHED_PASSWORDS_FILE if it is set.
+func loadPasswordPolicy() (auth.PasswordPolicy, error) {
+	policy := auth.DefaultPasswordPolicy
+	for name, field := range map[string]*int{
+		"PASSWORD_MIN_LENGTH":  &policy.MinLength,
+		"PASSWORD_MAX_LENGTH":  &policy.MaxLength,
+		"PASSWORD_MIN_CLASSES": &policy.MinClasses,
+	} {
+		value := os.Getenv(name)
+		if value == "" {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if (err != nil) || (n < 0) {
+			return policy, fmt.Errorf("%s must be a number of at least 0", name)
+		}
+		*field = n
+	}
+	if (policy.MaxLength > 0) && (policy.MaxLength < policy.MinLength) {
+		return policy, errors.New("PASSWORD_MAX_LENGTH is below PASSWORD_MIN_LENGTH")
+	}
+	if path := os.Getenv("BREACHED_PASSWORDS_FILE"); path != "" {
+		list, err := auth.LoadBreachList(path)
+		if err != nil {
+			return policy, err
+		}
+		log.Printf("Loaded %d breached password digests", list.Len())
+		policy.Breached = list
+	}
+	return policy, nil
+}
+
+// loadJWTKeys builds the key set from JWT_SIGNING_KEY_FILE, the PEM key new
+// tokens are signed with, and JWT_VERIFY_KEY_FILES, a comma separated list of
+// older keys whose tokens are still accepted after a rotation. Without a
+// signing key dev runs get a throwaway one.
+func loadJWTKeys() (*auth.KeySet, error) {
+	var signing *auth.SigningKey
+	var err error
+	if path := os.Getenv("JWT_SIGNING_KEY_FILE"); path != "" {
+		signing, err = auth.LoadKeyFile(path)
+	} else if apiconfig.platform == "dev" {
+		log.Printf("JWT_SIGNING_KEY_FILE not set, signing with a temporary key")
+		signing, err = auth.GenerateSigningKey()
+	} else {
+		err = errors.New("JWT_SIGNING_KEY_FILE is required")
+	}
+	if err != nil {
+		return nil, err
+	}
+	verify := []*auth.SigningKey{}
+	for _, path := range strings.Split(os.Getenv("JWT_VERIFY_KEY_FILES"), ",") {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+		key, err := auth.LoadKeyFile(path)
+		if err != nil {
+			return nil, err
+		}
+		verify = append(verify, key)
+	}
+	return auth.NewKeySet(signing, verify...)
+}
+
+// loadJWTConfig starts from auth.DefaultJWTConfig with the keys from
+// loadJWTKeys and applies JWT_ISSUER and JWT_AUDIENCE, plus the durations
+// JWT_ACCESS_TOKEN_LIFETIME, JWT_CLIENT_TOKEN_LIFETIME and JWT_LEEWAY in
+// time.ParseDuration format, like "15m".
+func loadJWTConfig() (*auth.JWTConfig, error) {
+	cfg := auth.DefaultJWTConfig
+	keys, err := loadJWTKeys()
+	if err != nil {
+		return nil, err
+	}
+	cfg.Keys = keys
+	if issuer := os.Getenv("JWT_ISSUER"); issuer != "" {
+		cfg.Issuer = issuer
+	}
+	if audience := os.Getenv("JWT_AUDIENCE"); audience != "" {
+		cfg.Audience = audience
+	}
+	for name, field := range map[string]*time.Duration{
+		"JWT_ACCESS_TOKEN_LIFETIME": &cfg.AccessTokenLifetime,
+		"JWT_CLIENT_TOKEN_LIFETIME": &cfg.ClientTokenLifetime,
+		"JWT_LEEWAY":                &cfg.Leeway,
+	} {
+		value := os.Getenv(name)
+		if value == "" {
+			continue
+		}
+		d, err := time.ParseDuration(value)
+		if (err != nil) || (d < 0) {
+			return nil, fmt.Errorf("%s must be a duration of at least 0, like 15m", name)
+		}
+		*field = d
+	}
+	if (cfg.AccessTokenLifetime == 0) || (cfg.ClientTokenLifetime == 0) {
+		return nil, errors.New("JWT_ACCESS_TOKEN_LIFETIME and JWT_CLIENT_TOKEN_LIFETIME must be above 0")
+	}
+	return &cfg, nil
+}
+
+func main() {
+	godotenv.Load()
+	dbURL := os.Getenv("DB_URL")
+	db, err := sql.Open("postgres", dbURL)
+	if err != nil {
+		return
+	}
+	mux := http.NewServeMux()
+	apiconfig = &apiConfig{db: db, dbQueries: database.New(db), platform: os.Getenv("PLATFORM"), polka_key: os.Getenv("POLKA_KEY"), admin_email: os.Getenv("ADMIN_EMAIL")}
+	apiconfig.base_url = strings.TrimSuffix(os.Getenv("BASE_URL"), "/")
+	if apiconfig.base_url == "" {
+		apiconfig.base_url = "http://localhost:8080"
+	}
+	apiconfig.require_verified_email = os.Getenv("REQUIRE_VERIFIED_EMAIL") == "true"
+	apiconfig.login_email_throttle = throttle.NewMemoryLimiter(loginEmailPolicy)
+	apiconfig.login_ip_throttle = throttle.NewMemoryLimiter(loginIPPolicy)
+	apiconfig.totp_throttle = throttle.NewMemoryLimiter(totpPolicy)
+	apiconfig.reset_email_throttle = throttle.NewMemoryLimiter(resetEmailPolicy)
+	apiconfig.reset_ip_throttle = throttle.NewMemoryLimiter(resetIPPolicy)
+	apiconfig.mailer, err = mail.NewFromEnv(os.Getenv)
+	if err != nil {
+		log.Fatalf("Could not set up mail: %v", err)
+	}
+	apiconfig.password_policy, err = loadPasswordPolicy()
+	if err != nil {
+		log.Fatalf("Could not load password policy: %v", err)
+	}
+	apiconfig.jwt_config, err = loadJWTConfig()
+	if err != nil {
+		log.Fatalf("Could not load JWT config: %v", err)
+	}
+	strategy, err := moderation.ParseStrategy(os.Getenv("PROFANITY_STRATEGY"))
+	if err != nil {
+		log.Fatalf("PROFANITY_STRATEGY: %v", err)
+	}
+	apiconfig.profanity, err = loadProfanityFilter(context.Background(), strategy)
+	if err != nil {
+		log.Fatalf("Could not load banned words: %v", err)
+	}
+	go reloadBannedWords(bannedWordsReloadInterval)
+	// ADMIN_EMAIL bootstraps the first admin, who can then hand out roles
+	// through /admin/users/{userID}/role. Only a verified account is
+	// promoted, so whoever signs up first with the address gains nothing,
+	// and only while there is no admin, so a demoted account stays demoted.
+	if apiconfig.admin_email != "" {
+		promoted, err := apiconfig.dbQueries.SetRoleByEmail(context.Background(), database.SetRoleByEmailParams{Role: auth.RoleAdmin, Email: apiconfig.admin_email})
+		if err != nil {
+			log.Fatalf("Could not set admin role: %v", err)
+		}
+		if promoted == 0 {
+			log.Printf("ADMIN_EMAIL was not promoted: there is an admin already, or no verified account with the email yet")
+		}
+	}
+	mux.Handle("/app/", apiconfig.middlewareMetricsInc(http.StripPrefix("/app/", http.FileServer(http.Dir(".")))))
 	mux.Handle("/assets/", http.FileServer(http.Dir(".")))
-	mux.HandleFunc("GET /admin/metrics", func(w http.ResponseWriter, r *http.Request) {
+	mux.Handle("GET /admin/metrics", apiconfig.middlewareRequireRole(auth.RoleAdmin, func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "text/html; charset=UTF-8")
 		w.WriteHeader(http.StatusOK)
 		hitcount := apiconfig.fileserverHits.Load()
@@ -207,183 +2111,1722 @@ func main() {
     										<p>Chirpy has been visited %d times!</p>
   										</body>
 									</html>`, hitcount)))
+	}))
+	mux.Handle("POST /admin/reset", apiconfig.middlewareRequireRole(auth.RoleAdmin, func(w http.ResponseWriter, r *http.Request) {
+		// Wiping every table stays a dev-only tool even for admins.
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if apiconfig.platform == "dev" {
+			apiconfig.dbQueries.ResetTable(r.Context())
+			w.WriteHeader(http.StatusOK)
+			apiconfig.fileserverHits.Store(0)
+			w.Write([]byte(fmt.Sprintf("Hits: %v", apiconfig.fileserverHits.Load())))
+		} else {
+			w.WriteHeader(403)
+		}
+	}))
+	mux.Handle("GET /admin/moderation/words", apiconfig.middlewareRequireRole(auth.RoleModerator, func(w http.ResponseWriter, r *http.Request) {
+		wordsjson, err := json.Marshal(apiconfig.profanity.Words())
+		if err != nil {
+			returnwitherror(w, 500, "Could not marshall words")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(200)
+		w.Write(wordsjson)
+	}))
+	mux.Handle("POST /admin/moderation/words", apiconfig.middlewareRequireRole(auth.RoleAdmin, func(w http.ResponseWriter, r *http.Request) {
+		params := bannedWordInput{}
+		err := json.NewDecoder(r.Body).Decode(&params)
+		if err != nil {
+			returnwitherror(w, 400, "could not decode body")
+			return
+		}
+		word := moderation.NormalizeWord(params.Word)
+		if word == "" {
+			returnwitherror(w, 400, "Word must be a single word without punctuation")
+			return
+		}
+		err = apiconfig.dbQueries.AddBannedWord(r.Context(), word)
+		if err != nil {
+			returnwitherror(w, 500, "Could not save word")
+			return
+		}
+		apiconfig.profanity.Add(word)
+		w.WriteHeader(204)
+	}))
+	mux.Handle("DELETE /admin/moderation/words/{word}", apiconfig.middlewareRequireRole(auth.RoleAdmin, func(w http.ResponseWriter, r *http.Request) {
+		word := moderation.NormalizeWord(r.PathValue("word"))
+		err := apiconfig.dbQueries.RemoveBannedWord(r.Context(), word)
+		if err != nil {
+			returnwitherror(w, 500, "Could not remove word")
+			return
+		}
+		apiconfig.profanity.Remove(word)
+		w.WriteHeader(204)
+	}))
+	mux.Handle("GET /admin/moderation/reports", apiconfig.middlewareRequireRole(auth.RoleModerator, func(w http.ResponseWriter, r *http.Request) {
+		page, err := parsePageParams(r)
+		if err != nil {
+			returnwitherror(w, 400, err.Error())
+			return
+		}
+		reports, err := apiconfig.dbQueries.GetOpenReports(r.Context(), database.GetOpenReportsParams{CursorCreatedAt: page.CursorCreatedAt, CursorID: page.CursorID, PageSize: page.Limit + 1})
+		if err != nil {
+			returnwitherror(w, 500, "Could not get reports")
+			return
+		}
+		writeReportsPage(w, 200, reports, page, r)
+	}))
+	mux.Handle("POST /admin/moderation/chirps/{chirpID}/dismiss", apiconfig.middlewareRequireRole(auth.RoleModerator, func(w http.ResponseWriter, r *http.Request) {
+		chirpid, err := uuid.Parse(r.PathValue("chirpID"))
+		if err != nil {
+			returnwitherror(w, 400, "Invalid ChirpID")
+			return
+		}
+		resolved, err := apiconfig.dbQueries.ResolveReports(r.Context(), database.ResolveReportsParams{Resolution: sql.NullString{String: reportDismissed, Valid: true}, ChirpID: chirpid})
+		if err != nil {
+			returnwitherror(w, 500, "Could not resolve reports")
+			return
+		}
+		if resolved == 0 {
+			returnwitherror(w, 404, "No open reports for chirp")
+			return
+		}
+		w.WriteHeader(204)
+	}))
+	mux.Handle("POST /admin/moderation/chirps/{chirpID}/hide", apiconfig.middlewareRequireRole(auth.RoleModerator, func(w http.ResponseWriter, r *http.Request) {
+		chirpid, err := uuid.Parse(r.PathValue("chirpID"))
+		if err != nil {
+			returnwitherror(w, 400, "Invalid ChirpID")
+			return
+		}
+		hideChirp(w, 200, chirpid, r)
+	}))
+	mux.Handle("POST /admin/moderation/chirps/{chirpID}/unhide", apiconfig.middlewareRequireRole(auth.RoleModerator, func(w http.ResponseWriter, r *http.Request) {
+		chirpid, err := uuid.Parse(r.PathValue("chirpID"))
+		if err != nil {
+			returnwitherror(w, 400, "Invalid ChirpID")
+			return
+		}
+		chirp, err := apiconfig.dbQueries.UnhideChirp(r.Context(), chirpid)
+		if err != nil {
+			returnwitherror(w, 404, "Could not get chirps")
+			return
+		}
+		chirpjson, err := json.Marshal(chirpToOutput(chirp))
+		if err != nil {
+			returnwitherror(w, 500, "Could not marshall chirp")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(200)
+		w.Write(chirpjson)
+	}))
+	mux.Handle("DELETE /admin/moderation/chirps/{chirpID}", apiconfig.middlewareRequireRole(auth.RoleModerator, func(w http.ResponseWriter, r *http.Request) {
+		chirpid, err := uuid.Parse(r.PathValue("chirpID"))
+		if err != nil {
+			returnwitherror(w, 400, "Invalid ChirpID")
+			return
+		}
+		_, err = apiconfig.dbQueries.GetChirp(r.Context(), chirpid)
+		if err != nil {
+			returnwitherror(w, 404, "Could not get chirps")
+			return
+		}
+		deleteChirp(w, 204, chirpid, r)
+	}))
+	mux.Handle("PUT /admin/users/{userID}/role", apiconfig.middlewareRequireRole(auth.RoleAdmin, func(w http.ResponseWriter, r *http.Request) {
+		userid, err := uuid.Parse(r.PathValue("userID"))
+		if err != nil {
+			returnwitherror(w, 400, "Invalid UserID")
+			return
+		}
+		params := roleInput{}
+		err = json.NewDecoder(r.Body).Decode(&params)
+		if err != nil {
+			returnwitherror(w, 400, "could not decode body")
+			return
+		}
+		if !auth.ValidRole(params.Role) {
+			returnwitherror(w, 400, "Role must be user, moderator or admin")
+			return
+		}
+		user, err := apiconfig.dbQueries.UpdateUserRole(r.Context(), database.UpdateUserRoleParams{Role: params.Role, ID: userid})
+		if err != nil {
+			returnwitherror(w, 404, "Could not find user")
+			return
+		}
+		userstruct := userToOutput(user)
+		userjson, err := json.Marshal(userstruct)
+		if err != nil {
+			returnwitherror(w, 500, "Could not marshall userstruct")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(200)
+		w.Write(userjson)
+	}))
+	mux.HandleFunc("GET /.well-known/jwks.json", func(w http.ResponseWriter, r *http.Request) {
+		jwksjson, err := json.Marshal(apiconfig.jwt_config.Keys.JWKS())
+		if err != nil {
+			returnwitherror(w, 500, "Could not marshall keys")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		w.WriteHeader(200)
+		w.Write(jwksjson)
+	})
+	mux.HandleFunc("GET /api/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("OK"))
+	})
+	mux.HandleFunc("POST /api/chirps", func(w http.ResponseWriter, r *http.Request) {
+		decoder := json.NewDecoder(r.Body)
+		userid, ok := authenticate(w, r, auth.ScopeChirpsWrite)
+		if !ok {
+			return
+		}
+		params := chirpsInput{}
+		var check = 0
+		decoderr := decoder.Decode(&params)
+		if decoderr != nil {
+			check = returnwitherror(w, 500, "Something went wrong")
+		}
+		if (check == 0) && (len(params.Body) > 140) {
+			check = returnwitherror(w, 400, "Chirp is too long")
+		}
+		params.UserID = userid
+		if check == 0 {
+			createChirp(w, 201, params, r)
+		}
+	})
+	mux.HandleFunc("GET /api/chirps", func(w http.ResponseWriter, r *http.Request) {
+		authorID := r.URL.Query().Get("author_id")
+		page, err := parsePageParams(r)
+		if err != nil {
+			returnwitherror(w, 400, err.Error())
+			return
+		}
+		getchirps(w, 200, r, authorID, page)
+	})
+	mux.HandleFunc("GET /api/chirps/search", func(w http.ResponseWriter, r *http.Request) {
+		searchchirps(w, 200, r)
+	})
+	mux.HandleFunc("GET /api/hashtags/{tag}/chirps", func(w http.ResponseWriter, r *http.Request) {
+		tag := strings.ToLower(strings.TrimPrefix(r.PathValue("tag"), "#"))
+		page, err := parsePageParams(r)
+		if err != nil {
+			returnwitherror(w, 400, err.Error())
+			return
+		}
+		var chirps []database.Chirp
+		if page.Ascending {
+			chirps, err = apiconfig.dbQueries.GetChirpsByHashtag(r.Context(), database.GetChirpsByHashtagParams{Tag: tag, CursorCreatedAt: page.CursorCreatedAt, CursorID: page.CursorID, ViewerID: optionalViewer(r), PageSize: page.Limit + 1})
+		} else {
+			chirps, err = apiconfig.dbQueries.GetChirpsByHashtagDesc(r.Context(), database.GetChirpsByHashtagDescParams{Tag: tag, CursorCreatedAt: page.CursorCreatedAt, CursorID: page.CursorID, ViewerID: optionalViewer(r), PageSize: page.Limit + 1})
+		}
+		if err != nil {
+			returnwitherror(w, 500, "Could not get chirps")
+			return
+		}
+		writeChirpsPage(w, 200, chirps, page, r)
+	})
+	mux.HandleFunc("GET /api/hashtags/trending", func(w http.ResponseWriter, r *http.Request) {
+		window := defaultTrendWindow
+		if windowstring := r.URL.Query().Get("window"); windowstring != "" {
+			parsed, err := time.ParseDuration(windowstring)
+			if (err != nil) || (parsed <= 0) || (parsed > maxTrendWindow) {
+				returnwitherror(w, 400, fmt.Sprintf("window must be a duration up to %v", maxTrendWindow))
+				return
+			}
+			window = parsed
+		}
+		limit := int32(defaultTrendingLimit)
+		if r.URL.Query().Get("limit") != "" {
+			parsed, err := parseLimit(r)
+			if err != nil {
+				returnwitherror(w, 400, err.Error())
+				return
+			}
+			limit = parsed
+		}
+		rows, err := apiconfig.dbQueries.GetTrendingHashtags(r.Context(), database.GetTrendingHashtagsParams{WindowSeconds: int32(window.Seconds()), PageSize: limit})
+		if err != nil {
+			returnwitherror(w, 500, "Could not get trending hashtags")
+			return
+		}
+		arr := []trendingHashtag{}
+		for _, v := range rows {
+			arr = append(arr, trendingHashtag{Tag: v.Tag, UseCount: v.UseCount})
+		}
+		arrjson, err := json.Marshal(arr)
+		if err != nil {
+			returnwitherror(w, 500, "Could not marshall hashtags")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(200)
+		w.Write(arrjson)
+	})
+	mux.HandleFunc("POST /api/users", func(w http.ResponseWriter, r *http.Request) {
+		decoder := json.NewDecoder(r.Body)
+		params1 := emailquery{}
+		err := decoder.Decode(&params1)
+		if err != nil {
+			returnwitherror(w, 500, "Something went wrong")
+			return
+		}
+		if err = validateEmail(params1.Email); err != nil {
+			returnwitherror(w, 400, err.Error())
+			return
+		}
+		if !checkPassword(w, params1.Password, params1.Email) {
+			return
+		}
+		handle := sql.NullString{}
+		if params1.Handle != nil {
+			var ok bool
+			handle, ok = claimHandle(w, *params1.Handle, uuid.Nil, r)
+			if !ok {
+				return
+			}
+		}
+		hashed_password, err := auth.HashPassword(params1.Password)
+		if err != nil {
+			returnwitherror(w, 400, "Password Cant Be Hashed")
+			return
+		}
+		user, err := apiconfig.dbQueries.CreateUser(r.Context(), database.CreateUserParams{Email: params1.Email, HashedPassword: hashed_password, Handle: handle})
+		if handleTakenError(err) {
+			returnwitherror(w, 409, "Handle is already taken")
+			return
+		} else if err != nil {
+			returnwitherror(w, 500, "Could not create User")
+			return
+		}
+		// The account exists either way; a lost email can be sent again from
+		// POST /api/users/verify-email/resend.
+		err = startEmailVerification(r.Context(), user.ID, user.Email)
+		if err != nil {
+			log.Printf("could not start email verification for user %v: %v", user.ID, err)
+		}
+		returnUser(w, 201, user, r)
+	})
+	// The emailed link only opens a page that confirms with a POST, so mail
+	// scanners and link previews fetching it do not use up the token.
+	mux.HandleFunc("GET /api/users/verify-email", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=UTF-8")
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("Referrer-Policy", "no-referrer")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(verifyEmailPage))
+	})
+	mux.HandleFunc("POST /api/users/verify-email", func(w http.ResponseWriter, r *http.Request) {
+		params := verifyEmailInput{}
+		err := json.NewDecoder(r.Body).Decode(&params)
+		if err != nil {
+			returnwitherror(w, 400, "could not decode body")
+			return
+		}
+		token := params.Token
+		if token == "" {
+			returnwitherror(w, 400, "Token is required")
+			return
+		}
+		tx, err := apiconfig.db.BeginTx(r.Context(), nil)
+		if err != nil {
+			returnwitherror(w, 500, "Could not verify email")
+			return
+		}
+		defer tx.Rollback()
+		qtx := apiconfig.dbQueries.WithTx(tx)
+		verification, err := qtx.GetEmailVerificationToken(r.Context(), auth.HashToken(token))
+		if err != nil {
+			returnwitherror(w, 401, "Verification link is invalid or expired")
+			return
+		}
+		// Confirming one address voids every other pending link, so an
+		// older email change cannot be applied afterwards.
+		used, err := qtx.UseEmailVerificationTokens(r.Context(), verification.UserID)
+		if err != nil {
+			returnwitherror(w, 500, "Could not verify email")
+			return
+		}
+		if used == 0 {
+			returnwitherror(w, 401, "Verification link is invalid or expired")
+			return
+		}
+		owner, err := qtx.UserByEmail(r.Context(), verification.Email)
+		if (err == nil) && (owner.ID != verification.UserID) {
+			returnwitherror(w, 409, "Email is already taken")
+			return
+		}
+		if (err != nil) && !errors.Is(err, sql.ErrNoRows) {
+			returnwitherror(w, 500, "Could not check email")
+			return
+		}
+		user, err := qtx.VerifyEmail(r.Context(), database.VerifyEmailParams{Email: verification.Email, ID: verification.UserID})
+		if err != nil {
+			returnwitherror(w, 500, "Could not verify email")
+			return
+		}
+		if err = tx.Commit(); err != nil {
+			returnwitherror(w, 500, "Could not verify email")
+			return
+		}
+		userjson, err := json.Marshal(userToOutput(user))
+		if err != nil {
+			returnwitherror(w, 500, "Could not marshall userstruct")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(200)
+		w.Write(userjson)
+	})
+	mux.HandleFunc("POST /api/users/verify-email/resend", func(w http.ResponseWriter, r *http.Request) {
+		tokenID, ok := authenticate(w, r, auth.ScopeAccount)
+		if !ok {
+			return
+		}
+		user, err := apiconfig.dbQueries.UserByID(r.Context(), tokenID)
+		if err != nil {
+			returnwitherror(w, 404, "Could not find user")
+			return
+		}
+		if user.EmailVerifiedAt.Valid {
+			returnwitherror(w, 409, "Email is already verified")
+			return
+		}
+		err = startEmailVerification(r.Context(), user.ID, user.Email)
+		if err != nil {
+			returnwitherror(w, 500, "Could not send verification email")
+			return
+		}
+		w.WriteHeader(202)
+	})
+	mux.HandleFunc("POST /api/login", func(w http.ResponseWriter, r *http.Request) {
+		decoder := json.NewDecoder(r.Body)
+		params1 := emailquery{}
+		err := decoder.Decode(&params1)
+		if err != nil {
+			returnwitherror(w, 500, "Something went wrong")
+			return
+		}
+		emailKey := strings.ToLower(strings.TrimSpace(params1.Email))
+		ip := clientIP(r)
+		if !startLoginAttempt(w, r, emailKey, ip) {
+			return
+		}
+		user, err := apiconfig.dbQueries.UserByEmail(r.Context(), params1.Email)
+		if (err != nil) || (auth.CheckPasswordHash(params1.Password, user.HashedPassword) != nil) {
+			returnwitherror(w, 401, "Incorrect email or password")
+			return
+		}
+		refundLoginAttempt(r.Context(), emailKey, ip)
+		// The password is only ever known here, so this is where hashes from
+		// an older scheme or cost get upgraded. The old hash is part of the
+		// update so a password changed in the meantime is left alone, and
+		// failing does not stop the login; it is tried again next time.
+		if auth.PasswordNeedsRehash(user.HashedPassword) {
+			rehashed, err := auth.HashPassword(params1.Password)
+			if err == nil {
+				_, err = apiconfig.dbQueries.RehashPassword(r.Context(), database.RehashPasswordParams{HashedPassword: rehashed, ID: user.ID, HashedPassword_2: user.HashedPassword})
+			}
+			if err != nil {
+				log.Printf("could not rehash password of user %v: %v", user.ID, err)
+			}
+		}
+		// With two-factor authentication on the failures are kept until
+		// the second factor is right too, which counts its wrong codes
+		// against the same email.
+		totp, err := apiconfig.dbQueries.GetTOTP(r.Context(), user.ID)
+		if (err == nil) && totp.EnabledAt.Valid {
+			startLoginChallenge(w, 200, user, r)
+			return
+		} else if (err != nil) && !errors.Is(err, sql.ErrNoRows) {
+			returnwitherror(w, 500, "Could not check two-factor authentication")
+			return
+		}
+		resetLoginThrottle(r.Context(), emailKey)
+		returnUser(w, 200, user, r)
+	})
+	mux.HandleFunc("POST /api/password-reset", func(w http.ResponseWriter, r *http.Request) {
+		params := passwordResetInput{}
+		err := json.NewDecoder(r.Body).Decode(&params)
+		if err != nil {
+			returnwitherror(w, 400, "could not decode body")
+			return
+		}
+		if !startResetAttempt(w, r, strings.ToLower(strings.TrimSpace(params.Email)), clientIP(r)) {
+			return
+		}
+		// Always 202 without touching the account, so this endpoint cannot
+		// be used to find out which emails have accounts.
+		go startPasswordReset(params.Email)
+		w.WriteHeader(202)
+	})
+	mux.HandleFunc("POST /api/password-reset/confirm", func(w http.ResponseWriter, r *http.Request) {
+		params := passwordResetInput{}
+		err := json.NewDecoder(r.Body).Decode(&params)
+		if err != nil {
+			returnwitherror(w, 400, "could not decode body")
+			return
+		}
+		tx, err := apiconfig.db.BeginTx(r.Context(), nil)
+		if err != nil {
+			returnwitherror(w, 500, "Could not reset password")
+			return
+		}
+		defer tx.Rollback()
+		qtx := apiconfig.dbQueries.WithTx(tx)
+		reset, err := qtx.GetPasswordResetToken(r.Context(), auth.HashToken(params.Token))
+		if err != nil {
+			returnwitherror(w, 401, "Reset token is invalid or expired")
+			return
+		}
+		// Checked before the token is used, so a refused password can be
+		// fixed and sent again with the same token.
+		user, err := qtx.UserByID(r.Context(), reset.UserID)
+		if err != nil {
+			returnwitherror(w, 500, "Could not reset password")
+			return
+		}
+		if !checkPassword(w, params.Password, user.Email) {
+			return
+		}
+		hashed_password, err := auth.HashPassword(params.Password)
+		if err != nil {
+			returnwitherror(w, 400, "Password Cant Be Hashed")
+			return
+		}
+		// Using one token burns every outstanding token of the user. Zero
+		// rows means a concurrent confirm got here first.
+		used, err := qtx.UsePasswordResetTokens(r.Context(), reset.UserID)
+		if err != nil {
+			returnwitherror(w, 500, "Could not reset password")
+			return
+		}
+		if used == 0 {
+			returnwitherror(w, 401, "Reset token is invalid or expired")
+			return
+		}
+		_, err = qtx.ChangePassword(r.Context(), database.ChangePasswordParams{HashedPassword: hashed_password, ID: reset.UserID})
+		if err != nil {
+			returnwitherror(w, 500, "Could not reset password")
+			return
+		}
+		// Whoever knew the old password may still be logged in.
+		_, err = qtx.RevokeAllSessions(r.Context(), reset.UserID)
+		if err != nil {
+			returnwitherror(w, 500, "Could not revoke sessions")
+			return
+		}
+		if err = tx.Commit(); err != nil {
+			returnwitherror(w, 500, "Could not reset password")
+			return
+		}
+		w.WriteHeader(204)
+	})
+	mux.HandleFunc("POST /api/login/2fa", func(w http.ResponseWriter, r *http.Request) {
+		params := twoFactorInput{}
+		err := json.NewDecoder(r.Body).Decode(&params)
+		if err != nil {
+			returnwitherror(w, 400, "could not decode body")
+			return
+		}
+		challenge, err := apiconfig.dbQueries.GetLoginChallenge(r.Context(), database.GetLoginChallengeParams{TokenHash: auth.HashToken(params.ChallengeToken), MaxAttempts: maxChallengeAttempts})
+		if err != nil {
+			returnwitherror(w, 401, "Challenge is invalid or expired")
+			return
+		}
+		user, err := apiconfig.dbQueries.UserByID(r.Context(), challenge.UserID)
+		if err != nil {
+			returnwitherror(w, 401, "Could not find user")
+			return
+		}
+		// Wrong codes count against the same email and IP as wrong
+		// passwords, so new challenges do not buy more guesses.
+		emailKey := strings.ToLower(user.Email)
+		ip := clientIP(r)
+		if !startLoginAttempt(w, r, emailKey, ip) {
+			return
+		}
+		totp, err := apiconfig.dbQueries.GetTOTP(r.Context(), challenge.UserID)
+		if (err != nil) || !totp.EnabledAt.Valid {
+			returnwitherror(w, 401, "Challenge is invalid or expired")
+			return
+		}
+		ok, err := checkSecondFactor(r.Context(), apiconfig.dbQueries, totp, params)
+		if err != nil {
+			returnwitherror(w, 500, "Could not check code")
+			return
+		}
+		if !ok {
+			err = apiconfig.dbQueries.FailLoginChallenge(r.Context(), challenge.ID)
+			if err != nil {
+				returnwitherror(w, 500, "Could not check code")
+				return
+			}
+			returnwitherror(w, 401, "Invalid code")
+			return
+		}
+		used, err := apiconfig.dbQueries.UseLoginChallenge(r.Context(), challenge.ID)
+		if (err != nil) || (used != 1) {
+			returnwitherror(w, 401, "Challenge is invalid or expired")
+			return
+		}
+		refundLoginAttempt(r.Context(), emailKey, ip)
+		resetLoginThrottle(r.Context(), emailKey)
+		returnUser(w, 200, user, r)
+	})
+	mux.HandleFunc("POST /api/2fa/enroll", func(w http.ResponseWriter, r *http.Request) {
+		tokenid, ok := authenticate(w, r, auth.ScopeAccount)
+		if !ok {
+			return
+		}
+		user, err := apiconfig.dbQueries.UserByID(r.Context(), tokenid)
+		if err != nil {
+			returnwitherror(w, 404, "Could not find user")
+			return
+		}
+		secret, err := auth.GenerateTOTPSecret()
+		if err != nil {
+			returnwitherror(w, 500, "Could not make secret")
+			return
+		}
+		_, err = apiconfig.dbQueries.StartTOTPEnrollment(r.Context(), database.StartTOTPEnrollmentParams{UserID: user.ID, Secret: secret})
+		if errors.Is(err, sql.ErrNoRows) {
+			returnwitherror(w, 409, "Two-factor authentication is already enabled")
+			return
+		} else if err != nil {
+			returnwitherror(w, 500, "Could not start enrollment")
+			return
+		}
+		enrolljson, err := json.Marshal(totpEnrollOutput{Secret: secret, OtpauthURI: auth.TOTPURI(secret, totpIssuer, user.Email), QRCodeURL: "/api/2fa/qr.png"})
+		if err != nil {
+			returnwitherror(w, 500, "Could not marshall enrollment")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(200)
+		w.Write(enrolljson)
+	})
+	mux.HandleFunc("GET /api/2fa/qr.png", func(w http.ResponseWriter, r *http.Request) {
+		tokenid, ok := authenticate(w, r, auth.ScopeAccount)
+		if !ok {
+			return
+		}
+		user, err := apiconfig.dbQueries.UserByID(r.Context(), tokenid)
+		if err != nil {
+			returnwitherror(w, 404, "Could not find user")
+			return
+		}
+		// Only pending enrollments have a QR code, the secret is never shown
+		// again once two-factor authentication is on.
+		totp, err := apiconfig.dbQueries.GetTOTP(r.Context(), tokenid)
+		if (err != nil) || totp.EnabledAt.Valid {
+			returnwitherror(w, 404, "No pending enrollment")
+			return
+		}
+		png, err := qrcode.Encode(auth.TOTPURI(totp.Secret, totpIssuer, user.Email), qrcode.Medium, totpQRSize)
+		if err != nil {
+			returnwitherror(w, 500, "Could not make QR code")
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(200)
+		w.Write(png)
+	})
+	mux.HandleFunc("POST /api/2fa/verify", func(w http.ResponseWriter, r *http.Request) {
+		tokenid, ok := authenticate(w, r, auth.ScopeAccount)
+		if !ok {
+			return
+		}
+		params := twoFactorInput{}
+		err := json.NewDecoder(r.Body).Decode(&params)
+		if err != nil {
+			returnwitherror(w, 400, "could not decode body")
+			return
+		}
+		totp, err := apiconfig.dbQueries.GetTOTP(r.Context(), tokenid)
+		if (err != nil) || totp.EnabledAt.Valid {
+			returnwitherror(w, 404, "No pending enrollment")
+			return
+		}
+		if !startCodeAttempt(w, r, tokenid) {
+			return
+		}
+		counter, ok := auth.ValidateTOTP(totp.Secret, params.Code, time.Now())
+		if !ok {
+			returnwitherror(w, 401, "Invalid code")
+			return
+		}
+		tx, err := apiconfig.db.BeginTx(r.Context(), nil)
+		if err != nil {
+			returnwitherror(w, 500, "Could not enable two-factor authentication")
+			return
+		}
+		defer tx.Rollback()
+		qtx := apiconfig.dbQueries.WithTx(tx)
+		// Only the secret the code was checked against is enabled, so an
+		// enrollment restarted in the meantime is not turned on by mistake.
+		enabled, err := qtx.EnableTOTP(r.Context(), database.EnableTOTPParams{UserID: tokenid, LastCounter: counter, Secret: totp.Secret})
+		if (err != nil) || (enabled != 1) {
+			returnwitherror(w, 409, "Could not enable two-factor authentication")
+			return
+		}
+		codes, err := issueRecoveryCodes(r.Context(), qtx, tokenid)
+		if err != nil {
+			returnwitherror(w, 500, "Could not make recovery codes")
+			return
+		}
+		if err = tx.Commit(); err != nil {
+			returnwitherror(w, 500, "Could not enable two-factor authentication")
+			return
+		}
+		resetCodeAttempts(r.Context(), tokenid)
+		writeRecoveryCodes(w, 200, codes)
+	})
+	mux.HandleFunc("POST /api/2fa/recovery-codes", func(w http.ResponseWriter, r *http.Request) {
+		tokenid, ok := authenticate(w, r, auth.ScopeAccount)
+		if !ok {
+			return
+		}
+		params := twoFactorInput{}
+		err := json.NewDecoder(r.Body).Decode(&params)
+		if err != nil {
+			returnwitherror(w, 400, "could not decode body")
+			return
+		}
+		totp, err := apiconfig.dbQueries.GetTOTP(r.Context(), tokenid)
+		if (err != nil) || !totp.EnabledAt.Valid {
+			returnwitherror(w, 404, "Two-factor authentication is not enabled")
+			return
+		}
+		// Only a current TOTP code will do, a recovery code cannot be used to
+		// mint more recovery codes.
+		params.RecoveryCode = ""
+		if !startCodeAttempt(w, r, tokenid) {
+			return
+		}
+		tx, err := apiconfig.db.BeginTx(r.Context(), nil)
+		if err != nil {
+			returnwitherror(w, 500, "Could not make recovery codes")
+			return
+		}
+		defer tx.Rollback()
+		qtx := apiconfig.dbQueries.WithTx(tx)
+		ok, err = checkSecondFactor(r.Context(), qtx, totp, params)
+		if err != nil {
+			returnwitherror(w, 500, "Could not check code")
+			return
+		}
+		if !ok {
+			returnwitherror(w, 401, "Invalid code")
+			return
+		}
+		codes, err := issueRecoveryCodes(r.Context(), qtx, tokenid)
+		if err != nil {
+			returnwitherror(w, 500, "Could not make recovery codes")
+			return
+		}
+		if err = tx.Commit(); err != nil {
+			returnwitherror(w, 500, "Could not make recovery codes")
+			return
+		}
+		resetCodeAttempts(r.Context(), tokenid)
+		writeRecoveryCodes(w, 200, codes)
+	})
+	mux.HandleFunc("POST /api/2fa/disable", func(w http.ResponseWriter, r *http.Request) {
+		tokenid, ok := authenticate(w, r, auth.ScopeAccount)
+		if !ok {
+			return
+		}
+		params := twoFactorInput{}
+		err := json.NewDecoder(r.Body).Decode(&params)
+		if err != nil {
+			returnwitherror(w, 400, "could not decode body")
+			return
+		}
+		if !startCodeAttempt(w, r, tokenid) {
+			return
+		}
+		user, err := apiconfig.dbQueries.UserByID(r.Context(), tokenid)
+		if (err != nil) || (auth.CheckPasswordHash(params.Password, user.HashedPassword) != nil) {
+			returnwitherror(w, 401, "Incorrect password")
+			return
+		}
+		totp, err := apiconfig.dbQueries.GetTOTP(r.Context(), tokenid)
+		if err != nil {
+			returnwitherror(w, 404, "Two-factor authentication is not enabled")
+			return
+		}
+		tx, err := apiconfig.db.BeginTx(r.Context(), nil)
+		if err != nil {
+			returnwitherror(w, 500, "Could not disable two-factor authentication")
+			return
+		}
+		defer tx.Rollback()
+		qtx := apiconfig.dbQueries.WithTx(tx)
+		// A pending enrollment can be dropped with the password alone.
+		if totp.EnabledAt.Valid {
+			ok, err := checkSecondFactor(r.Context(), qtx, totp, params)
+			if err != nil {
+				returnwitherror(w, 500, "Could not check code")
+				return
+			}
+			if !ok {
+				returnwitherror(w, 401, "Invalid code")
+				return
+			}
+		}
+		err = qtx.DeleteTOTP(r.Context(), tokenid)
+		if err != nil {
+			returnwitherror(w, 500, "Could not disable two-factor authentication")
+			return
+		}
+		err = qtx.DeleteRecoveryCodes(r.Context(), tokenid)
+		if err != nil {
+			returnwitherror(w, 500, "Could not disable two-factor authentication")
+			return
+		}
+		if err = tx.Commit(); err != nil {
+			returnwitherror(w, 500, "Could not disable two-factor authentication")
+			return
+		}
+		resetCodeAttempts(r.Context(), tokenid)
+		w.WriteHeader(204)
+	})
+	mux.HandleFunc("GET /api/chirps/{chirpID}", func(w http.ResponseWriter, r *http.Request) {
+		chirpidstring := r.PathValue("chirpID")
+		chirpid, err := uuid.Parse(chirpidstring)
+		if err != nil {
+			returnwitherror(w, 400, "Invalid ChirpID")
+			return
+		}
+		chirp, err := apiconfig.dbQueries.GetChirp(r.Context(), chirpid)
+		if (err != nil) || !chirpVisible(chirp, optionalViewer(r)) {
+			returnwitherror(w, 404, "Could not get chirps")
+			return
+		}
+		extras, err := loadChirpExtras(r, []database.Chirp{chirp})
+		if err != nil {
+			returnwitherror(w, 500, "Could not load chirps")
+			return
+		}
+		chirpstruct := extras.output(chirp)
+		chirpjson, err := json.Marshal(chirpstruct)
+		if err != nil {
+			returnwitherror(w, 500, "Could not marshall chirp")
+			return
+		}
+		w.WriteHeader(200)
+		w.Write(chirpjson)
+	})
+	mux.HandleFunc("POST /api/chirps/{chirpID}/likes", func(w http.ResponseWriter, r *http.Request) {
+		tokenid, ok := authenticate(w, r, auth.ScopeChirpsWrite)
+		if !ok {
+			return
+		}
+		chirpid, err := uuid.Parse(r.PathValue("chirpID"))
+		if err != nil {
+			returnwitherror(w, 400, "Invalid ChirpID")
+			return
+		}
+		chirp, err := apiconfig.dbQueries.GetChirp(r.Context(), chirpid)
+		if (err != nil) || !chirpVisible(chirp, uuid.NullUUID{UUID: tokenid, Valid: true}) {
+			returnwitherror(w, 404, "Could not get chirps")
+			return
+		}
+		err = apiconfig.dbQueries.LikeChirp(r.Context(), database.LikeChirpParams{UserID: tokenid, ChirpID: chirpid})
+		if err != nil {
+			returnwitherror(w, 500, "Could not like chirp")
+			return
+		}
+		w.WriteHeader(204)
+	})
+	mux.HandleFunc("DELETE /api/chirps/{chirpID}/likes", func(w http.ResponseWriter, r *http.Request) {
+		tokenid, ok := authenticate(w, r, auth.ScopeChirpsWrite)
+		if !ok {
+			return
+		}
+		chirpid, err := uuid.Parse(r.PathValue("chirpID"))
+		if err != nil {
+			returnwitherror(w, 400, "Invalid ChirpID")
+			return
+		}
+		chirp, err := apiconfig.dbQueries.GetChirp(r.Context(), chirpid)
+		if (err != nil) || !chirpVisible(chirp, uuid.NullUUID{UUID: tokenid, Valid: true}) {
+			returnwitherror(w, 404, "Could not get chirps")
+			return
+		}
+		err = apiconfig.dbQueries.UnlikeChirp(r.Context(), database.UnlikeChirpParams{UserID: tokenid, ChirpID: chirpid})
+		if err != nil {
+			returnwitherror(w, 500, "Could not unlike chirp")
+			return
+		}
+		w.WriteHeader(204)
+	})
+	mux.HandleFunc("POST /api/chirps/{chirpID}/reports", func(w http.ResponseWriter, r *http.Request) {
+		tokenid, ok := authenticate(w, r, auth.ScopeAccount)
+		if !ok {
+			return
+		}
+		chirpid, err := uuid.Parse(r.PathValue("chirpID"))
+		if err != nil {
+			returnwitherror(w, 400, "Invalid ChirpID")
+			return
+		}
+		params := reportInput{}
+		err = json.NewDecoder(r.Body).Decode(&params)
+		if err != nil {
+			returnwitherror(w, 400, "could not decode body")
+			return
+		}
+		reason := strings.TrimSpace(params.Reason)
+		if reason == "" {
+			returnwitherror(w, 400, "Reason is required")
+			return
+		}
+		if len(reason) > maxReportReasonLength {
+			returnwitherror(w, 400, "Reason is too long")
+			return
+		}
+		chirp, err := apiconfig.dbQueries.GetChirp(r.Context(), chirpid)
+		if (err != nil) || !chirpVisible(chirp, uuid.NullUUID{UUID: tokenid, Valid: true}) {
+			returnwitherror(w, 404, "Could not get chirps")
+			return
+		}
+		_, err = apiconfig.dbQueries.GetOpenReportByReporter(r.Context(), database.GetOpenReportByReporterParams{ChirpID: chirpid, ReporterID: tokenid})
+		if err == nil {
+			returnwitherror(w, 409, "Chirp already reported")
+			return
+		}
+		report, err := apiconfig.dbQueries.CreateReport(r.Context(), database.CreateReportParams{ChirpID: chirpid, ReporterID: tokenid, Reason: reason})
+		if err != nil {
+			returnwitherror(w, 500, "Could not create report")
+			return
+		}
+		reportjson, err := json.Marshal(reportOutput{ID: report.ID, ChirpID: report.ChirpID, ReporterID: report.ReporterID, Reason: report.Reason, CreatedAt: report.CreatedAt})
+		if err != nil {
+			returnwitherror(w, 500, "Could not marshall report")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(201)
+		w.Write(reportjson)
 	})
-	mux.HandleFunc("POST /admin/reset", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-		if apiconfig.platform == "dev" {
-			apiconfig.dbQueries.ResetTable(r.Context())
-			w.WriteHeader(http.StatusOK)
-			apiconfig.fileserverHits.Store(0)
-			w.Write([]byte(fmt.Sprintf("Hits: %v", apiconfig.fileserverHits.Load())))
+	mux.HandleFunc("POST /api/chirps/{chirpID}/rechirps", func(w http.ResponseWriter, r *http.Request) {
+		tokenid, ok := authenticate(w, r, auth.ScopeChirpsWrite)
+		if !ok {
+			return
+		}
+		chirpid, err := uuid.Parse(r.PathValue("chirpID"))
+		if err != nil {
+			returnwitherror(w, 400, "Invalid ChirpID")
+			return
+		}
+		params := chirpsInput{}
+		if r.ContentLength != 0 {
+			err = json.NewDecoder(r.Body).Decode(&params)
+			if err != nil {
+				returnwitherror(w, 400, "could not decode body")
+				return
+			}
+		}
+		if len(params.Body) > 140 {
+			returnwitherror(w, 400, "Chirp is too long")
+			return
+		}
+		original, err := apiconfig.dbQueries.GetChirp(r.Context(), chirpid)
+		if (err != nil) || !chirpVisible(original, uuid.NullUUID{UUID: tokenid, Valid: true}) {
+			returnwitherror(w, 404, "Could not get chirps")
+			return
+		}
+		// Rechirping a rechirp reposts what it points at, so chains never form.
+		if original.Kind == chirpKindRechirp {
+			if !original.OriginalID.Valid {
+				returnwitherror(w, 404, "Original chirp was deleted")
+				return
+			}
+			original, err = apiconfig.dbQueries.GetChirp(r.Context(), original.OriginalID.UUID)
+			if (err != nil) || !chirpVisible(original, uuid.NullUUID{UUID: tokenid, Valid: true}) {
+				returnwitherror(w, 404, "Original chirp was deleted")
+				return
+			}
+		}
+		params.UserID = tokenid
+		params.ParentID = nil
+		params.OriginalID = &original.ID
+		if params.Body == "" {
+			params.Kind = chirpKindRechirp
+			_, err = apiconfig.dbQueries.GetRechirpByUser(r.Context(), database.GetRechirpByUserParams{UserID: tokenid, OriginalID: uuid.NullUUID{UUID: original.ID, Valid: true}})
+			if err == nil {
+				returnwitherror(w, 409, "Chirp is already rechirped")
+				return
+			}
+			if !errors.Is(err, sql.ErrNoRows) {
+				returnwitherror(w, 500, "Could not check rechirps")
+				return
+			}
 		} else {
-			w.WriteHeader(403)
+			params.Kind = chirpKindQuote
+		}
+		createChirp(w, 201, params, r)
+	})
+	mux.HandleFunc("GET /api/chirps/{chirpID}/replies", func(w http.ResponseWriter, r *http.Request) {
+		chirpid, err := uuid.Parse(r.PathValue("chirpID"))
+		if err != nil {
+			returnwitherror(w, 400, "Invalid ChirpID")
+			return
+		}
+		page, err := parsePageParams(r)
+		if err != nil {
+			returnwitherror(w, 400, err.Error())
+			return
+		}
+		parent, err := apiconfig.dbQueries.GetChirp(r.Context(), chirpid)
+		if (err != nil) || !chirpVisible(parent, optionalViewer(r)) {
+			returnwitherror(w, 404, "Could not get chirps")
+			return
+		}
+		// Replies always read top to bottom like a conversation.
+		page.Ascending = true
+		replies, err := apiconfig.dbQueries.GetChirpReplies(r.Context(), database.GetChirpRepliesParams{ParentID: uuid.NullUUID{UUID: chirpid, Valid: true}, CursorCreatedAt: page.CursorCreatedAt, CursorID: page.CursorID, ViewerID: optionalViewer(r), PageSize: page.Limit + 1})
+		if err != nil {
+			returnwitherror(w, 500, "Could not get replies")
+			return
+		}
+		writeChirpsPage(w, 200, replies, page, r)
+	})
+	mux.HandleFunc("GET /api/chirps/{chirpID}/thread", func(w http.ResponseWriter, r *http.Request) {
+		chirpid, err := uuid.Parse(r.PathValue("chirpID"))
+		if err != nil {
+			returnwitherror(w, 400, "Invalid ChirpID")
+			return
+		}
+		chirp, err := apiconfig.dbQueries.GetChirp(r.Context(), chirpid)
+		if (err != nil) || !chirpVisible(chirp, optionalViewer(r)) {
+			returnwitherror(w, 404, "Could not get chirps")
+			return
+		}
+		ancestors, err := apiconfig.dbQueries.GetChirpAncestors(r.Context(), chirpid)
+		if err != nil {
+			returnwitherror(w, 500, "Could not get thread")
+			return
+		}
+		descendants, err := apiconfig.dbQueries.GetChirpDescendants(r.Context(), uuid.NullUUID{UUID: chirpid, Valid: true})
+		if err != nil {
+			returnwitherror(w, 500, "Could not get thread")
+			return
+		}
+		extras, err := loadChirpExtras(r, append(append([]database.Chirp{chirp}, ancestors...), descendants...))
+		if err != nil {
+			returnwitherror(w, 500, "Could not load chirps")
+			return
+		}
+		thread := threadOutput{Root: extras.output(chirp), Ancestors: []chirpsOutput{}, Chirp: buildThread(chirp, descendants, extras)}
+		for _, v := range ancestors {
+			if chirpVisible(v, extras.viewer) {
+				thread.Ancestors = append(thread.Ancestors, extras.output(v))
+			}
+		}
+		if len(thread.Ancestors) > 0 {
+			thread.Root = thread.Ancestors[0]
+		}
+		threadjson, err := json.Marshal(thread)
+		if err != nil {
+			returnwitherror(w, 500, "Could not marshall thread")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(200)
+		w.Write(threadjson)
+	})
+	mux.HandleFunc("PUT /api/chirps/{chirpID}", func(w http.ResponseWriter, r *http.Request) {
+		tokenid, ok := authenticate(w, r, auth.ScopeChirpsWrite)
+		if !ok {
+			return
+		}
+		chirpid, err := uuid.Parse(r.PathValue("chirpID"))
+		if err != nil {
+			returnwitherror(w, 400, "Invalid ChirpID")
+			return
+		}
+		params := chirpsInput{}
+		err = json.NewDecoder(r.Body).Decode(&params)
+		if err != nil {
+			returnwitherror(w, 400, "could not decode body")
+			return
+		}
+		if len(params.Body) > 140 {
+			returnwitherror(w, 400, "Chirp is too long")
+			return
+		}
+		chirp, err := apiconfig.dbQueries.GetChirp(r.Context(), chirpid)
+		if err != nil {
+			returnwitherror(w, 404, "Could not get chirps")
+			return
+		}
+		if chirp.UserID != tokenid {
+			returnwitherror(w, 403, "You can only edit your own chirps")
+			return
+		}
+		if chirp.Kind == chirpKindRechirp {
+			returnwitherror(w, 400, "Rechirps can not be edited")
+			return
+		}
+		editChirp(w, 200, chirp, params.Body, r)
+	})
+	mux.HandleFunc("GET /api/chirps/{chirpID}/revisions", func(w http.ResponseWriter, r *http.Request) {
+		chirpid, err := uuid.Parse(r.PathValue("chirpID"))
+		if err != nil {
+			returnwitherror(w, 400, "Invalid ChirpID")
+			return
+		}
+		chirp, err := apiconfig.dbQueries.GetChirp(r.Context(), chirpid)
+		if (err != nil) || !chirpVisible(chirp, optionalViewer(r)) {
+			returnwitherror(w, 404, "Could not get chirps")
+			return
+		}
+		revisions, err := apiconfig.dbQueries.GetChirpRevisions(r.Context(), chirpid)
+		if err != nil {
+			returnwitherror(w, 500, "Could not get revisions")
+			return
+		}
+		arr := []chirpRevisionOutput{}
+		for _, v := range revisions {
+			arr = append(arr, chirpRevisionOutput{ID: v.ID, ChirpID: v.ChirpID, Body: v.Body, CreatedAt: v.CreatedAt, ReplacedAt: v.ReplacedAt})
+		}
+		arrjson, err := json.Marshal(arr)
+		if err != nil {
+			returnwitherror(w, 500, "Could not marshall revisions")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(200)
+		w.Write(arrjson)
+	})
+	mux.HandleFunc("POST /api/refresh", func(w http.ResponseWriter, r *http.Request) {
+		token, err := auth.GetBearerToken(r.Header)
+		if err != nil {
+			returnwitherror(w, 400, "No Token Provided")
+			return
+		}
+		rotateRefreshToken(w, 200, token, r)
+	})
+	mux.HandleFunc("POST /api/revoke", func(w http.ResponseWriter, r *http.Request) {
+		token, err := auth.GetBearerToken(r.Header)
+		if err != nil {
+			returnwitherror(w, 400, "No Token Provided")
+			return
+		}
+		tokenquery, err := findRefreshToken(r.Context(), apiconfig.dbQueries, token)
+		if err != nil {
+			returnwitherror(w, 401, "Could not find token")
+			return
+		}
+		_, err = apiconfig.dbQueries.RevokeRefreshToken(r.Context(), tokenquery.ID)
+		if err != nil {
+			returnwitherror(w, 500, "Could not Revoke Token")
+			return
+		}
+		w.WriteHeader(204)
+	})
+	mux.HandleFunc("GET /api/sessions", func(w http.ResponseWriter, r *http.Request) {
+		tokenid, ok := authenticate(w, r, auth.ScopeAccount)
+		if !ok {
+			return
+		}
+		sessions, err := apiconfig.dbQueries.GetSessions(r.Context(), tokenid)
+		if err != nil {
+			returnwitherror(w, 500, "Could not get sessions")
+			return
+		}
+		resp := []sessionOutput{}
+		for _, v := range sessions {
+			resp = append(resp, sessionOutput{ID: v.FamilyID, UserAgent: v.UserAgent, IP: v.Ip, StartedAt: v.StartedAt, LastUsedAt: v.LastUsedAt, ExpiresAt: v.ExpiresAt})
+		}
+		respjson, err := json.Marshal(resp)
+		if err != nil {
+			returnwitherror(w, 500, "Could not marshall sessions")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(200)
+		w.Write(respjson)
+	})
+	mux.HandleFunc("DELETE /api/sessions/{sessionID}", func(w http.ResponseWriter, r *http.Request) {
+		tokenid, ok := authenticate(w, r, auth.ScopeAccount)
+		if !ok {
+			return
+		}
+		sessionid, err := uuid.Parse(r.PathValue("sessionID"))
+		if err != nil {
+			returnwitherror(w, 400, "Invalid SessionID")
+			return
+		}
+		revoked, err := apiconfig.dbQueries.RevokeSession(r.Context(), database.RevokeSessionParams{UserID: tokenid, FamilyID: sessionid})
+		if err != nil {
+			returnwitherror(w, 500, "Could not revoke session")
+			return
+		}
+		if revoked == 0 {
+			returnwitherror(w, 404, "Could not find session")
+			return
+		}
+		w.WriteHeader(204)
+	})
+	mux.HandleFunc("DELETE /api/sessions", func(w http.ResponseWriter, r *http.Request) {
+		tokenid, ok := authenticate(w, r, auth.ScopeAccount)
+		if !ok {
+			return
+		}
+		_, err := apiconfig.dbQueries.RevokeAllSessions(r.Context(), tokenid)
+		if err != nil {
+			returnwitherror(w, 500, "Could not revoke sessions")
+			return
+		}
+		w.WriteHeader(204)
+	})
+	// API keys are managed with the account scope only a login has, so a
+	// leaked key can not be used to mint more keys.
+	mux.HandleFunc("POST /api/api-keys", func(w http.ResponseWriter, r *http.Request) {
+		tokenid, ok := authenticate(w, r, auth.ScopeAccount)
+		if !ok {
+			return
+		}
+		params := apiKeyInput{}
+		err := json.NewDecoder(r.Body).Decode(&params)
+		if err != nil {
+			returnwitherror(w, 400, "could not decode body")
+			return
+		}
+		params.Name = strings.TrimSpace(params.Name)
+		if (params.Name == "") || (utf8.RuneCountInString(params.Name) > maxAPIKeyNameLength) {
+			returnwitherror(w, 400, fmt.Sprintf("Name must be 1 to %d characters", maxAPIKeyNameLength))
+			return
+		}
+		if len(params.Scopes) == 0 {
+			returnwitherror(w, 400, "At least one scope is required")
+			return
+		}
+		scopes := []string{}
+		for _, scope := range params.Scopes {
+			if !auth.ValidScope(scope) {
+				returnwitherror(w, 400, "Unknown scope "+scope)
+				return
+			}
+			if !slices.Contains(scopes, scope) {
+				scopes = append(scopes, scope)
+			}
+		}
+		key, err := auth.MakeAPIKey()
+		if err != nil {
+			returnwitherror(w, 500, "Could not make API key")
+			return
+		}
+		apikey, err := apiconfig.dbQueries.CreateAPIKey(r.Context(), database.CreateAPIKeyParams{UserID: tokenid, Name: params.Name, KeyPrefix: auth.APIKeyPrefix(key), KeyHash: auth.HashToken(key), Scopes: scopes})
+		if err != nil {
+			returnwitherror(w, 500, "Could not save API key")
+			return
+		}
+		output := apiKeyToOutput(apikey)
+		output.Key = &key
+		keyjson, err := json.Marshal(output)
+		if err != nil {
+			returnwitherror(w, 500, "Could not marshall API key")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(201)
+		w.Write(keyjson)
+	})
+	mux.HandleFunc("GET /api/api-keys", func(w http.ResponseWriter, r *http.Request) {
+		tokenid, ok := authenticate(w, r, auth.ScopeAccount)
+		if !ok {
+			return
+		}
+		apikeys, err := apiconfig.dbQueries.GetAPIKeys(r.Context(), tokenid)
+		if err != nil {
+			returnwitherror(w, 500, "Could not get API keys")
+			return
+		}
+		resp := []apiKeyOutput{}
+		for _, v := range apikeys {
+			resp = append(resp, apiKeyToOutput(v))
+		}
+		respjson, err := json.Marshal(resp)
+		if err != nil {
+			returnwitherror(w, 500, "Could not marshall API keys")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(200)
+		w.Write(respjson)
+	})
+	mux.HandleFunc("DELETE /api/api-keys/{keyID}", func(w http.ResponseWriter, r *http.Request) {
+		tokenid, ok := authenticate(w, r, auth.ScopeAccount)
+		if !ok {
+			return
+		}
+		keyid, err := uuid.Parse(r.PathValue("keyID"))
+		if err != nil {
+			returnwitherror(w, 400, "Invalid KeyID")
+			return
+		}
+		revoked, err := apiconfig.dbQueries.RevokeAPIKey(r.Context(), database.RevokeAPIKeyParams{ID: keyid, UserID: tokenid})
+		if err != nil {
+			returnwitherror(w, 500, "Could not revoke API key")
+			return
+		}
+		if revoked == 0 {
+			returnwitherror(w, 404, "Could not find API key")
+			return
+		}
+		w.WriteHeader(204)
+	})
+	// OAuth clients, their authorization requests and the grants users gave
+	// them are all managed with the account scope only a login has; a client
+	// token can not register clients or approve itself more scopes.
+	mux.HandleFunc("POST /api/oauth/clients", func(w http.ResponseWriter, r *http.Request) {
+		tokenid, ok := authenticate(w, r, auth.ScopeAccount)
+		if !ok {
+			return
+		}
+		params := oauthClientInput{}
+		err := json.NewDecoder(r.Body).Decode(&params)
+		if err != nil {
+			returnwitherror(w, 400, "could not decode body")
+			return
+		}
+		params.Name = strings.TrimSpace(params.Name)
+		if (params.Name == "") || (utf8.RuneCountInString(params.Name) > maxOAuthClientNameLength) {
+			returnwitherror(w, 400, fmt.Sprintf("Name must be 1 to %d characters", maxOAuthClientNameLength))
+			return
+		}
+		if (len(params.RedirectURIs) == 0) || (len(params.RedirectURIs) > maxRedirectURIs) {
+			returnwitherror(w, 400, fmt.Sprintf("1 to %d redirect uris are required", maxRedirectURIs))
+			return
+		}
+		redirectURIs := []string{}
+		for _, uri := range params.RedirectURIs {
+			if err = auth.ValidateRedirectURI(uri); err != nil {
+				returnwitherror(w, 400, err.Error())
+				return
+			}
+			if !slices.Contains(redirectURIs, uri) {
+				redirectURIs = append(redirectURIs, uri)
+			}
+		}
+		if len(params.Scopes) == 0 {
+			returnwitherror(w, 400, "At least one scope is required")
+			return
+		}
+		scopes := []string{}
+		for _, scope := range params.Scopes {
+			if !auth.ValidScope(scope) {
+				returnwitherror(w, 400, "Unknown scope "+scope)
+				return
+			}
+			if !slices.Contains(scopes, scope) {
+				scopes = append(scopes, scope)
+			}
+		}
+		var secret string
+		var secretHash []byte
+		if !params.Public {
+			secret, err = auth.MakeRefreshToken()
+			if err != nil {
+				returnwitherror(w, 500, "Could not make client secret")
+				return
+			}
+			secretHash = auth.HashToken(secret)
 		}
-	})
-	mux.HandleFunc("GET /api/healthz", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("OK"))
-	})
-	mux.HandleFunc("POST /api/chirps", func(w http.ResponseWriter, r *http.Request) {
-		decoder := json.NewDecoder(r.Body)
-		token, err := auth.GetBearerToken(r.Header)
+		client, err := apiconfig.dbQueries.CreateOAuthClient(r.Context(), database.CreateOAuthClientParams{OwnerID: tokenid, Name: params.Name, SecretHash: secretHash, RedirectUris: redirectURIs, Scopes: scopes})
 		if err != nil {
-			returnwitherror(w, 400, "Could Not Find Token")
+			returnwitherror(w, 500, "Could not save client")
 			return
 		}
-		params := chirpsInput{}
-		var check = 0
-		decoderr := decoder.Decode(&params)
-		if decoderr != nil {
-			check = returnwitherror(w, 500, "Something went wrong")
+		output := oauthClientToOutput(client)
+		if !params.Public {
+			output.ClientSecret = &secret
 		}
-		if len(params.Body) > 140 {
-			check = returnwitherror(w, 400, "Chirp is too long")
+		clientjson, err := json.Marshal(output)
+		if err != nil {
+			returnwitherror(w, 500, "Could not marshall client")
+			return
 		}
-		jwt_userid, err := auth.ValidateJWT(token, apiconfig.jwt_Secret)
-		params.UserID = jwt_userid
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(201)
+		w.Write(clientjson)
+	})
+	mux.HandleFunc("GET /api/oauth/clients", func(w http.ResponseWriter, r *http.Request) {
+		tokenid, ok := authenticate(w, r, auth.ScopeAccount)
+		if !ok {
+			return
+		}
+		clients, err := apiconfig.dbQueries.GetOAuthClientsByOwner(r.Context(), tokenid)
 		if err != nil {
-			check = returnwitherror(w, 401, "Jwt could not be validated")
+			returnwitherror(w, 500, "Could not get clients")
+			return
 		}
-		if check == 0 {
-			createChirp(w, 201, params, r)
+		resp := []oauthClientOutput{}
+		for _, v := range clients {
+			resp = append(resp, oauthClientToOutput(v))
 		}
-	})
-	mux.HandleFunc("GET /api/chirps", func(w http.ResponseWriter, r *http.Request) {
-		authorID := r.URL.Query().Get("author_id")
-		sort := r.URL.Query().Get("sort")
-		if (sort == "") || (sort == "asc") {
-			sort = "ASC"
-		} else {
-			sort = "DESC"
+		respjson, err := json.Marshal(resp)
+		if err != nil {
+			returnwitherror(w, 500, "Could not marshall clients")
+			return
 		}
-		getchirps(w, 200, r, authorID, sort)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(200)
+		w.Write(respjson)
 	})
-	mux.HandleFunc("POST /api/users", func(w http.ResponseWriter, r *http.Request) {
-		decoder := json.NewDecoder(r.Body)
-		params1 := emailquery{}
-		err := decoder.Decode(&params1)
+	mux.HandleFunc("DELETE /api/oauth/clients/{clientID}", func(w http.ResponseWriter, r *http.Request) {
+		tokenid, ok := authenticate(w, r, auth.ScopeAccount)
+		if !ok {
+			return
+		}
+		clientid, err := uuid.Parse(r.PathValue("clientID"))
 		if err != nil {
-			returnwitherror(w, 500, "Something went wrong")
+			returnwitherror(w, 400, "Invalid ClientID")
 			return
 		}
-		hashed_password, err := auth.HashPassword(params1.Password)
+		tx, err := apiconfig.db.BeginTx(r.Context(), nil)
 		if err != nil {
-			returnwitherror(w, 400, "Password Cant Be Hashed")
+			returnwitherror(w, 500, "Could not start transaction")
 			return
 		}
-		user, err := apiconfig.dbQueries.CreateUser(r.Context(), database.CreateUserParams{Email: params1.Email, HashedPassword: hashed_password})
+		defer tx.Rollback()
+		qtx := apiconfig.dbQueries.WithTx(tx)
+		revoked, err := qtx.RevokeOAuthClient(r.Context(), database.RevokeOAuthClientParams{ID: clientid, OwnerID: tokenid})
 		if err != nil {
-			returnwitherror(w, 500, "Could not create User")
+			returnwitherror(w, 500, "Could not revoke client")
 			return
 		}
-		returnUser(w, 201, user, r)
-	})
-	mux.HandleFunc("POST /api/login", func(w http.ResponseWriter, r *http.Request) {
-		decoder := json.NewDecoder(r.Body)
-		params1 := emailquery{}
-		err := decoder.Decode(&params1)
+		if revoked == 0 {
+			returnwitherror(w, 404, "Could not find client")
+			return
+		}
+		_, err = qtx.RevokeClientRefreshTokens(r.Context(), uuid.NullUUID{UUID: clientid, Valid: true})
 		if err != nil {
-			returnwitherror(w, 500, "Something went wrong")
+			returnwitherror(w, 500, "Could not revoke client tokens")
 			return
 		}
-		user, err := apiconfig.dbQueries.UserByEmail(r.Context(), params1.Email)
-		if (err != nil) || (auth.CheckPasswordHash(params1.Password, user.HashedPassword) != nil) {
-			returnwitherror(w, 401, "Incorrect email or password")
+		if err = tx.Commit(); err != nil {
+			returnwitherror(w, 500, "Could not commit transaction")
 			return
 		}
-		returnUser(w, 200, user, r)
+		w.WriteHeader(204)
 	})
-	mux.HandleFunc("GET /api/chirps/{chirpID}", func(w http.ResponseWriter, r *http.Request) {
-		chirpidstring := r.PathValue("chirpID")
-		chirpid, err := uuid.Parse(chirpidstring)
+	// The authorize endpoints back the consent screen of a front-end: GET
+	// checks the request and says what the client asks for, POST records the
+	// user's answer and returns where to send them back to.
+	mux.HandleFunc("GET /api/oauth/authorize", func(w http.ResponseWriter, r *http.Request) {
+		tokenid, ok := authenticate(w, r, auth.ScopeAccount)
+		if !ok {
+			return
+		}
+		query := r.URL.Query()
+		params := authorizeInput{ResponseType: query.Get("response_type"), ClientID: query.Get("client_id"), RedirectURI: query.Get("redirect_uri"), Scope: query.Get("scope"), State: query.Get("state"), CodeChallenge: query.Get("code_challenge"), CodeChallengeMethod: query.Get("code_challenge_method")}
+		client, redirectURI, scopes, ok := checkAuthorizeRequest(w, r, params)
+		if !ok {
+			return
+		}
+		consented := false
+		consent, err := apiconfig.dbQueries.GetOAuthConsent(r.Context(), database.GetOAuthConsentParams{UserID: tokenid, ClientID: client.ID})
+		if err == nil {
+			consented = true
+			for _, scope := range scopes {
+				consented = consented && slices.Contains(consent.Scopes, scope)
+			}
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			returnwitherror(w, 500, "Could not get consent")
+			return
+		}
+		respjson, err := json.Marshal(authorizeOutput{ClientID: client.ID, ClientName: client.Name, RedirectURI: redirectURI, Scopes: scopes, Consented: consented})
 		if err != nil {
-			returnwitherror(w, 400, "Invalid ChirpID")
+			returnwitherror(w, 500, "Could not marshall authorization request")
 			return
 		}
-		chirp, err := apiconfig.dbQueries.GetChirp(r.Context(), chirpid)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(200)
+		w.Write(respjson)
+	})
+	mux.HandleFunc("POST /api/oauth/authorize", func(w http.ResponseWriter, r *http.Request) {
+		tokenid, ok := authenticate(w, r, auth.ScopeAccount)
+		if !ok {
+			return
+		}
+		params := authorizeInput{}
+		err := json.NewDecoder(r.Body).Decode(&params)
 		if err != nil {
-			returnwitherror(w, 404, "Could not get chirps")
+			returnwitherror(w, 400, "could not decode body")
 			return
 		}
-		chirpstruct := chirpsOutput{ID: chirp.ID, CreatedAt: chirp.CreatedAt, UpdatedAt: chirp.UpdatedAt, Body: chirp.Body, UserID: chirp.UserID}
-		chirpjson, err := json.Marshal(chirpstruct)
+		client, redirectURI, scopes, ok := checkAuthorizeRequest(w, r, params)
+		if !ok {
+			return
+		}
+		values := url.Values{}
+		if params.State != "" {
+			values.Set("state", params.State)
+		}
+		if !params.Approve {
+			values.Set("error", "access_denied")
+		} else {
+			code, err := auth.MakeRefreshToken()
+			if err != nil {
+				returnwitherror(w, 500, "Could not make authorization code")
+				return
+			}
+			tx, err := apiconfig.db.BeginTx(r.Context(), nil)
+			if err != nil {
+				returnwitherror(w, 500, "Could not start transaction")
+				return
+			}
+			defer tx.Rollback()
+			qtx := apiconfig.dbQueries.WithTx(tx)
+			_, err = qtx.UpsertOAuthConsent(r.Context(), database.UpsertOAuthConsentParams{UserID: tokenid, ClientID: client.ID, Scopes: scopes})
+			if err != nil {
+				returnwitherror(w, 500, "Could not save consent")
+				return
+			}
+			_, err = qtx.CreateAuthorizationCode(r.Context(), database.CreateAuthorizationCodeParams{CodeHash: auth.HashToken(code), ClientID: client.ID, UserID: tokenid, RedirectUri: redirectURI, Scopes: scopes, CodeChallenge: params.CodeChallenge})
+			if err != nil {
+				returnwitherror(w, 500, "Could not save authorization code")
+				return
+			}
+			if err = tx.Commit(); err != nil {
+				returnwitherror(w, 500, "Could not commit transaction")
+				return
+			}
+			values.Set("code", code)
+		}
+		redirectTo, err := withQuery(redirectURI, values)
 		if err != nil {
-			returnwitherror(w, 500, "Could not marshall chirp")
+			returnwitherror(w, 500, "Could not build redirect")
 			return
 		}
+		respjson, err := json.Marshal(authorizeRedirect{RedirectTo: redirectTo})
+		if err != nil {
+			returnwitherror(w, 500, "Could not marshall redirect")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(200)
-		w.Write(chirpjson)
+		w.Write(respjson)
 	})
-	mux.HandleFunc("POST /api/refresh", func(w http.ResponseWriter, r *http.Request) {
-		token, err := auth.GetBearerToken(r.Header)
+	mux.HandleFunc("POST /api/oauth/token", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+		err := r.ParseForm()
 		if err != nil {
-			returnwitherror(w, 400, "No Token Provided")
+			returnOAuthError(w, 400, "invalid_request", "could not decode body")
 			return
 		}
-		tokenquery, err := apiconfig.dbQueries.QueryRefreshToken(r.Context(), token)
-		if err != nil {
-			returnwitherror(w, 401, "Could not find token / is expired")
+		client, ok := authenticateClient(w, r)
+		if !ok {
+			return
+		}
+		switch r.PostForm.Get("grant_type") {
+		case "authorization_code":
+			exchangeAuthorizationCode(w, r, client)
+		case "refresh_token":
+			old, refreshToken, err := exchangeRefreshToken(r, r.PostForm.Get("refresh_token"), uuid.NullUUID{UUID: client.ID, Valid: true})
+			if errors.Is(err, errInvalidRefreshToken) {
+				returnOAuthError(w, 400, "invalid_grant", "Refresh token is invalid, expired or revoked")
+				return
+			}
+			if err != nil {
+				returnOAuthError(w, 500, "server_error", "Could not refresh token")
+				return
+			}
+			writeOAuthToken(w, old.UserID, client.ID, old.Scopes, refreshToken)
+		default:
+			returnOAuthError(w, 400, "unsupported_grant_type", "grant_type must be authorization_code or refresh_token")
+		}
+	})
+	mux.HandleFunc("GET /api/oauth/authorizations", func(w http.ResponseWriter, r *http.Request) {
+		tokenid, ok := authenticate(w, r, auth.ScopeAccount)
+		if !ok {
 			return
 		}
-		acctoken, err := auth.MakeJWT(tokenquery.UserID, apiconfig.jwt_Secret)
+		consents, err := apiconfig.dbQueries.GetOAuthConsents(r.Context(), tokenid)
 		if err != nil {
-			returnwitherror(w, 500, "Could not make jwt")
+			returnwitherror(w, 500, "Could not get authorizations")
 			return
 		}
-		accstruct := tokenstruct{Token: acctoken}
-		accjson, err := json.Marshal(accstruct)
+		resp := []authorizationOutput{}
+		for _, v := range consents {
+			resp = append(resp, authorizationOutput{ClientID: v.ClientID, ClientName: v.Name, Scopes: v.Scopes, CreatedAt: v.CreatedAt, UpdatedAt: v.UpdatedAt})
+		}
+		respjson, err := json.Marshal(resp)
 		if err != nil {
-			returnwitherror(w, 500, "Could not marshall json")
+			returnwitherror(w, 500, "Could not marshall authorizations")
 			return
 		}
+		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(200)
-		w.Write(accjson)
-
+		w.Write(respjson)
 	})
-	mux.HandleFunc("POST /api/revoke", func(w http.ResponseWriter, r *http.Request) {
-		token, err := auth.GetBearerToken(r.Header)
+	// Withdrawing consent also revokes the client's refresh tokens for the
+	// user; its access tokens run out on their own.
+	mux.HandleFunc("DELETE /api/oauth/authorizations/{clientID}", func(w http.ResponseWriter, r *http.Request) {
+		tokenid, ok := authenticate(w, r, auth.ScopeAccount)
+		if !ok {
+			return
+		}
+		clientid, err := uuid.Parse(r.PathValue("clientID"))
 		if err != nil {
-			returnwitherror(w, 400, "No Token Provided")
+			returnwitherror(w, 400, "Invalid ClientID")
 			return
 		}
-		_, err = apiconfig.dbQueries.RevokeRefreshToken(r.Context(), token)
+		tx, err := apiconfig.db.BeginTx(r.Context(), nil)
 		if err != nil {
-			returnwitherror(w, 500, "Could not Revoke Token")
+			returnwitherror(w, 500, "Could not start transaction")
+			return
+		}
+		defer tx.Rollback()
+		qtx := apiconfig.dbQueries.WithTx(tx)
+		deleted, err := qtx.DeleteOAuthConsent(r.Context(), database.DeleteOAuthConsentParams{UserID: tokenid, ClientID: clientid})
+		if err != nil {
+			returnwitherror(w, 500, "Could not delete authorization")
+			return
+		}
+		if deleted == 0 {
+			returnwitherror(w, 404, "Could not find authorization")
+			return
+		}
+		_, err = qtx.RevokeClientRefreshTokensForUser(r.Context(), database.RevokeClientRefreshTokensForUserParams{ClientID: uuid.NullUUID{UUID: clientid, Valid: true}, UserID: tokenid})
+		if err != nil {
+			returnwitherror(w, 500, "Could not revoke client tokens")
+			return
+		}
+		if err = tx.Commit(); err != nil {
+			returnwitherror(w, 500, "Could not commit transaction")
 			return
 		}
 		w.WriteHeader(204)
 	})
 	mux.HandleFunc("PUT /api/users", func(w http.ResponseWriter, r *http.Request) {
-		decoder := json.NewDecoder(r.Body)
-		token, err := auth.GetBearerToken(r.Header)
-		if err != nil {
-			returnwitherror(w, 401, "No token Provided")
+		tokenID, ok := authenticate(w, r, auth.ScopeAccount)
+		if !ok {
 			return
 		}
 		params := emailquery{}
-		err = decoder.Decode(&params)
+		err := json.NewDecoder(r.Body).Decode(&params)
 		if err != nil {
 			returnwitherror(w, 400, "could not decode body")
 			return
 		}
-		tokenID, err := auth.ValidateJWT(token, apiconfig.jwt_Secret)
+		user, err := apiconfig.dbQueries.UserByID(r.Context(), tokenID)
 		if err != nil {
-			returnwitherror(w, 401, "There is a problem with your token")
+			returnwitherror(w, 404, "Could not find user")
 			return
 		}
-		hashedpsw, err := auth.HashPassword(params.Password)
-		if err != nil {
-			returnwitherror(w, 500, "could not hash password")
+		// A body that only sets a handle leaves the password alone, and one
+		// that changes the email sends the current password to confirm it.
+		// Everything is checked before anything is saved, and the saves share
+		// one transaction, so a refused change does not leave the others half
+		// applied.
+		changeEmail := (params.Email != "") && (params.Email != user.Email)
+		if changeEmail {
+			if err = validateEmail(params.Email); err != nil {
+				returnwitherror(w, 400, err.Error())
+				return
+			}
+			_, err = apiconfig.dbQueries.UserByEmail(r.Context(), params.Email)
+			if err == nil {
+				returnwitherror(w, 409, "Email is already taken")
+				return
+			}
+			if !errors.Is(err, sql.ErrNoRows) {
+				returnwitherror(w, 500, "Could not check email")
+				return
+			}
+			// The new address can reset the password, so changing it takes
+			// the current password, guessed no faster than at login.
+			emailKey := strings.ToLower(user.Email)
+			ip := clientIP(r)
+			if !startLoginAttempt(w, r, emailKey, ip) {
+				return
+			}
+			if auth.CheckPasswordHash(params.Password, user.HashedPassword) != nil {
+				returnwitherror(w, 401, "Incorrect password")
+				return
+			}
+			refundLoginAttempt(r.Context(), emailKey, ip)
+		}
+		changePassword := !changeEmail && ((params.Password != "") || ((params.Handle == nil) && (params.Email == "")))
+		if changePassword && !checkPassword(w, params.Password, user.Email) {
 			return
 		}
-		qres, err := apiconfig.dbQueries.ChangePassword(r.Context(), database.ChangePasswordParams{HashedPassword: hashedpsw, ID: tokenID})
+		handle := sql.NullString{}
+		if params.Handle != nil {
+			handle, ok = claimHandle(w, *params.Handle, tokenID, r)
+			if !ok {
+				return
+			}
+		}
+		hashedpsw := ""
+		if changePassword {
+			hashedpsw, err = auth.HashPassword(params.Password)
+			if err != nil {
+				returnwitherror(w, 500, "could not hash password")
+				return
+			}
+		}
+		tx, err := apiconfig.db.BeginTx(r.Context(), nil)
 		if err != nil {
-			returnwitherror(w, 500, "password change failed")
+			returnwitherror(w, 500, "Could not update user")
+			return
+		}
+		defer tx.Rollback()
+		qtx := apiconfig.dbQueries.WithTx(tx)
+		if params.Handle != nil {
+			_, err = qtx.UpdateHandle(r.Context(), database.UpdateHandleParams{Handle: handle, ID: tokenID})
+			if handleTakenError(err) {
+				returnwitherror(w, 409, "Handle is already taken")
+				return
+			} else if err != nil {
+				returnwitherror(w, 500, "handle change failed")
+				return
+			}
+			params.Handle = &handle.String
+		}
+		if changePassword {
+			_, err = qtx.ChangePassword(r.Context(), database.ChangePasswordParams{HashedPassword: hashedpsw, ID: tokenID})
+			if err != nil {
+				returnwitherror(w, 500, "password change failed")
+				return
+			}
+			params.Password = hashedpsw
+		}
+		// The new address only replaces the current one once the link
+		// sent to it has been opened.
+		var verification mail.Message
+		if changeEmail {
+			verification, err = createEmailVerification(r.Context(), qtx, tokenID, params.Email)
+			if err != nil {
+				returnwitherror(w, 500, "Could not send verification email")
+				return
+			}
+			// It only confirmed the change, so it is not echoed back.
+			params.Password = ""
+		}
+		if err = tx.Commit(); err != nil {
+			returnwitherror(w, 500, "Could not update user")
 			return
 		}
-		_ = qres
-		params.Password = hashedpsw
+		if changeEmail {
+			go sendMail(tokenID, verification)
+		}
 		paramsjson, err := json.Marshal(params)
 		if err != nil {
 			returnwitherror(w, 500, "could not marshall return parameters")
@@ -393,9 +3836,8 @@ func main() {
 		w.Write(paramsjson)
 	})
 	mux.HandleFunc("DELETE /api/chirps/{chirpID}", func(w http.ResponseWriter, r *http.Request) {
-		token, err := auth.GetBearerToken(r.Header)
-		if err != nil {
-			returnwitherror(w, 401, "No token Provided")
+		tokenid, ok := authenticate(w, r, auth.ScopeChirpsWrite)
+		if !ok {
 			return
 		}
 		chirpidstring := r.PathValue("chirpID")
@@ -409,21 +3851,165 @@ func main() {
 			returnwitherror(w, 404, "Could not get chirps")
 			return
 		}
-		chirpstruct := chirpsOutput{ID: chirp.ID, CreatedAt: chirp.CreatedAt, UpdatedAt: chirp.UpdatedAt, Body: chirp.Body, UserID: chirp.UserID}
-		tokenid, err := auth.ValidateJWT(token, apiconfig.jwt_Secret)
+		chirpstruct := chirpToOutput(chirp)
+		if chirpstruct.UserID == tokenid {
+			deleteChirp(w, 204, chirpstruct.ID, r)
+			return
+		}
+		w.WriteHeader(403)
+	})
+	mux.HandleFunc("POST /api/users/{userID}/follow", func(w http.ResponseWriter, r *http.Request) {
+		tokenid, ok := authenticate(w, r, auth.ScopeAccount)
+		if !ok {
+			return
+		}
+		followeeid, err := uuid.Parse(r.PathValue("userID"))
 		if err != nil {
-			returnwitherror(w, 400, "Token could not be verified")
+			returnwitherror(w, 400, "Invalid UserID")
 			return
 		}
-		if chirpstruct.UserID == tokenid {
-			err = apiconfig.dbQueries.DeleteChirp(r.Context(), chirpstruct.ID)
+		if followeeid == tokenid {
+			returnwitherror(w, 400, "You can not follow yourself")
+			return
+		}
+		_, err = apiconfig.dbQueries.UserByID(r.Context(), followeeid)
+		if err != nil {
+			returnwitherror(w, 404, "Could not find user")
+			return
+		}
+		err = apiconfig.dbQueries.FollowUser(r.Context(), database.FollowUserParams{FollowerID: tokenid, FolloweeID: followeeid})
+		if err != nil {
+			returnwitherror(w, 500, "Could not follow user")
+			return
+		}
+		w.WriteHeader(204)
+	})
+	mux.HandleFunc("DELETE /api/users/{userID}/follow", func(w http.ResponseWriter, r *http.Request) {
+		tokenid, ok := authenticate(w, r, auth.ScopeAccount)
+		if !ok {
+			return
+		}
+		followeeid, err := uuid.Parse(r.PathValue("userID"))
+		if err != nil {
+			returnwitherror(w, 400, "Invalid UserID")
+			return
+		}
+		err = apiconfig.dbQueries.UnfollowUser(r.Context(), database.UnfollowUserParams{FollowerID: tokenid, FolloweeID: followeeid})
+		if err != nil {
+			returnwitherror(w, 500, "Could not unfollow user")
+			return
+		}
+		w.WriteHeader(204)
+	})
+	mux.HandleFunc("GET /api/users/{userID}/followers", func(w http.ResponseWriter, r *http.Request) {
+		userid, err := uuid.Parse(r.PathValue("userID"))
+		if err != nil {
+			returnwitherror(w, 400, "Invalid UserID")
+			return
+		}
+		page, err := parsePageParams(r)
+		if err != nil {
+			returnwitherror(w, 400, err.Error())
+			return
+		}
+		arr := []followOutput{}
+		if page.Ascending {
+			followers, err := apiconfig.dbQueries.GetFollowers(r.Context(), database.GetFollowersParams{UserID: userid, CursorCreatedAt: page.CursorCreatedAt, CursorID: page.CursorID, PageSize: page.Limit + 1})
 			if err != nil {
-				returnwitherror(w, 500, "Could not delete chirp")
+				returnwitherror(w, 500, "Could not get followers")
 				return
 			}
-			w.WriteHeader(204)
+			for _, v := range followers {
+				arr = append(arr, followOutput{UserID: v.FollowerID, FollowedAt: v.CreatedAt})
+			}
+		} else {
+			followers, err := apiconfig.dbQueries.GetFollowersDesc(r.Context(), database.GetFollowersDescParams{UserID: userid, CursorCreatedAt: page.CursorCreatedAt, CursorID: page.CursorID, PageSize: page.Limit + 1})
+			if err != nil {
+				returnwitherror(w, 500, "Could not get followers")
+				return
+			}
+			for _, v := range followers {
+				arr = append(arr, followOutput{UserID: v.FollowerID, FollowedAt: v.CreatedAt})
+			}
 		}
-		w.WriteHeader(403)
+		writeFollowsPage(w, 200, arr, page)
+	})
+	mux.HandleFunc("GET /api/users/{userID}/following", func(w http.ResponseWriter, r *http.Request) {
+		userid, err := uuid.Parse(r.PathValue("userID"))
+		if err != nil {
+			returnwitherror(w, 400, "Invalid UserID")
+			return
+		}
+		page, err := parsePageParams(r)
+		if err != nil {
+			returnwitherror(w, 400, err.Error())
+			return
+		}
+		arr := []followOutput{}
+		if page.Ascending {
+			following, err := apiconfig.dbQueries.GetFollowing(r.Context(), database.GetFollowingParams{UserID: userid, CursorCreatedAt: page.CursorCreatedAt, CursorID: page.CursorID, PageSize: page.Limit + 1})
+			if err != nil {
+				returnwitherror(w, 500, "Could not get following")
+				return
+			}
+			for _, v := range following {
+				arr = append(arr, followOutput{UserID: v.FolloweeID, FollowedAt: v.CreatedAt})
+			}
+		} else {
+			following, err := apiconfig.dbQueries.GetFollowingDesc(r.Context(), database.GetFollowingDescParams{UserID: userid, CursorCreatedAt: page.CursorCreatedAt, CursorID: page.CursorID, PageSize: page.Limit + 1})
+			if err != nil {
+				returnwitherror(w, 500, "Could not get following")
+				return
+			}
+			for _, v := range following {
+				arr = append(arr, followOutput{UserID: v.FolloweeID, FollowedAt: v.CreatedAt})
+			}
+		}
+		writeFollowsPage(w, 200, arr, page)
+	})
+	mux.HandleFunc("GET /api/mentions", func(w http.ResponseWriter, r *http.Request) {
+		tokenid, ok := authenticate(w, r, auth.ScopeChirpsRead)
+		if !ok {
+			return
+		}
+		page, err := parsePageParams(r)
+		if err != nil {
+			returnwitherror(w, 400, err.Error())
+			return
+		}
+		var chirps []database.Chirp
+		if page.Ascending {
+			chirps, err = apiconfig.dbQueries.GetMentions(r.Context(), database.GetMentionsParams{UserID: tokenid, CursorCreatedAt: page.CursorCreatedAt, CursorID: page.CursorID, PageSize: page.Limit + 1})
+		} else {
+			chirps, err = apiconfig.dbQueries.GetMentionsDesc(r.Context(), database.GetMentionsDescParams{UserID: tokenid, CursorCreatedAt: page.CursorCreatedAt, CursorID: page.CursorID, PageSize: page.Limit + 1})
+		}
+		if err != nil {
+			returnwitherror(w, 500, "Could not get mentions")
+			return
+		}
+		writeChirpsPage(w, 200, chirps, page, r)
+	})
+	mux.HandleFunc("GET /api/timeline", func(w http.ResponseWriter, r *http.Request) {
+		tokenid, ok := authenticate(w, r, auth.ScopeChirpsRead)
+		if !ok {
+			return
+		}
+		page, err := parsePageParams(r)
+		if err != nil {
+			returnwitherror(w, 400, err.Error())
+			return
+		}
+		var chirps []database.Chirp
+		if page.Ascending {
+			chirps, err = apiconfig.dbQueries.GetTimeline(r.Context(), database.GetTimelineParams{FollowerID: tokenid, CursorCreatedAt: page.CursorCreatedAt, CursorID: page.CursorID, PageSize: page.Limit + 1})
+		} else {
+			chirps, err = apiconfig.dbQueries.GetTimelineDesc(r.Context(), database.GetTimelineDescParams{FollowerID: tokenid, CursorCreatedAt: page.CursorCreatedAt, CursorID: page.CursorID, PageSize: page.Limit + 1})
+		}
+		if err != nil {
+			returnwitherror(w, 500, "Could not get timeline")
+			return
+		}
+		writeChirpsPage(w, 200, chirps, page, r)
 	})
 	mux.HandleFunc("POST /api/polka/webhooks", func(w http.ResponseWriter, r *http.Request) {
 		apikey, err := auth.GetAPIKey(r.Header)
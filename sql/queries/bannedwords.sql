@@ -0,0 +1,20 @@
+-- name: GetBannedWords :many
+SELECT word FROM banned_words
+ORDER BY word;
+
+-- name: AddBannedWord :exec
+INSERT INTO banned_words (word, created_at)
+VALUES (
+    $1,
+    NOW()
+)
+ON CONFLICT (word) DO NOTHING;
+
+-- name: RemoveBannedWord :exec
+DELETE FROM banned_words
+WHERE word=$1;
+
+-- name: MarkBannedWordsSeeded :execrows
+INSERT INTO banned_words_seeded (seeded_at)
+VALUES (NOW())
+ON CONFLICT (id) DO NOTHING;
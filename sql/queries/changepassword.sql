@@ -2,4 +2,8 @@
 UPDATE users
 SET hashed_password=$1
 WHERE id=$2
-RETURNING *;
\ No newline at end of file
+RETURNING *;
+-- name: RehashPassword :execrows
+UPDATE users
+SET hashed_password=$1
+WHERE (id=$2) AND (hashed_password=$3);
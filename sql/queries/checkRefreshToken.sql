@@ -1,2 +1,2 @@
--- name: QueryRefreshToken :one
-SELECT * FROM refresh_tokens WHERE (token=$1) AND (expires_at>NOW()) AND (revoked_at IS NULL);
\ No newline at end of file
+-- name: QueryRefreshToken :many
+SELECT * FROM refresh_tokens WHERE (token_prefix=$1) AND (expires_at>NOW());
\ No newline at end of file
@@ -0,0 +1,31 @@
+-- name: GetChirpReplies :many
+Select * from chirps
+WHERE (parent_id=sqlc.arg('parent_id'))
+    AND ((sqlc.narg('cursor_created_at')::timestamp IS NULL)
+    OR ((created_at, id) > (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid)))
+    AND ((hidden_at IS NULL) OR (user_id=sqlc.narg('viewer_id')))
+ORDER BY created_at ASC, id ASC
+LIMIT sqlc.arg('page_size');
+
+-- name: GetChirpAncestors :many
+WITH RECURSIVE ancestors(id, parent_id, depth) AS (
+    SELECT c.id, c.parent_id, 1 FROM chirps c
+    WHERE c.id = (SELECT p.parent_id FROM chirps p WHERE p.id=$1)
+    UNION ALL
+    SELECT c.id, c.parent_id, a.depth + 1 FROM chirps c
+    JOIN ancestors a ON c.id = a.parent_id
+)
+SELECT chirps.* FROM chirps
+JOIN ancestors ON chirps.id = ancestors.id
+ORDER BY ancestors.depth DESC;
+
+-- name: GetChirpDescendants :many
+WITH RECURSIVE descendants(id) AS (
+    SELECT c.id FROM chirps c WHERE c.parent_id=$1
+    UNION ALL
+    SELECT c.id FROM chirps c
+    JOIN descendants d ON c.parent_id = d.id
+)
+SELECT chirps.* FROM chirps
+JOIN descendants ON chirps.id = descendants.id
+ORDER BY chirps.created_at ASC, chirps.id ASC;
@@ -1,11 +1,19 @@
 -- name: CreateRefreshToken :one
-INSERT INTO refresh_tokens(token, created_at, updated_at, user_id, expires_at, revoked_at)
+INSERT INTO refresh_tokens(id, token_prefix, token_hash, created_at, updated_at, user_id, expires_at, revoked_at, family_id, user_agent, ip, last_used_at, client_id, scopes)
 VALUES (
+    gen_random_uuid(),
     $1,
+    $2,
     NOW(),
     NOW(),
-    $2,
+    $3,
     (NOW() + INTERVAL '60 days'),
-    NULL
+    NULL,
+    $4,
+    $5,
+    $6,
+    NOW(),
+    $7,
+    $8
 )
 RETURNING *;
\ No newline at end of file
@@ -1,4 +1,8 @@
 -- name: DeleteChirp :exec
 DELETE FROM chirps
 WHERE id=$1
-RETURNING *;
\ No newline at end of file
+RETURNING *;
+
+-- name: DeleteRechirps :exec
+DELETE FROM chirps
+WHERE original_id=$1 AND kind='rechirp';
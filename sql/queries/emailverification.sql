@@ -0,0 +1,26 @@
+-- name: CreateEmailVerificationToken :one
+INSERT INTO email_verification_tokens (id, token_hash, user_id, email, created_at, expires_at)
+VALUES (
+    gen_random_uuid(),
+    $1,
+    $2,
+    $3,
+    NOW(),
+    NOW() + INTERVAL '24 hours'
+)
+RETURNING *;
+
+-- name: GetEmailVerificationToken :one
+SELECT * FROM email_verification_tokens
+WHERE (token_hash=$1) AND (expires_at>NOW()) AND (used_at IS NULL);
+
+-- name: UseEmailVerificationTokens :execrows
+UPDATE email_verification_tokens
+SET used_at=NOW()
+WHERE (user_id=$1) AND (used_at IS NULL);
+
+-- name: VerifyEmail :one
+UPDATE users
+SET email=$1, email_verified_at=NOW(), updated_at=NOW()
+WHERE id=$2
+RETURNING *;
@@ -1,3 +1,15 @@
 -- name: GetChirps :many
 Select * from chirps
-ORDER BY created_at;
\ No newline at end of file
+WHERE ((sqlc.narg('cursor_created_at')::timestamp IS NULL)
+    OR ((created_at, id) > (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid)))
+    AND ((hidden_at IS NULL) OR (user_id=sqlc.narg('viewer_id')))
+ORDER BY created_at ASC, id ASC
+LIMIT sqlc.arg('page_size');
+
+-- name: GetChirpsDesc :many
+Select * from chirps
+WHERE ((sqlc.narg('cursor_created_at')::timestamp IS NULL)
+    OR ((created_at, id) < (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid)))
+    AND ((hidden_at IS NULL) OR (user_id=sqlc.narg('viewer_id')))
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg('page_size');
@@ -1,2 +1,8 @@
 -- name: GetChirp :one
-Select * from chirps WHERE id=$1;
\ No newline at end of file
+Select * from chirps WHERE id=$1;
+
+-- name: GetChirpsByIDs :many
+Select * from chirps WHERE id = ANY(sqlc.arg('ids')::uuid[]);
+
+-- name: GetChirpForUpdate :one
+Select * from chirps WHERE id=$1 FOR UPDATE;
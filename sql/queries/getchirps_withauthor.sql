@@ -1,3 +1,17 @@
 -- name: GetChirpsByAuthor :many
-Select * from chirps where user_id=$1
-ORDER BY created_at;
\ No newline at end of file
+Select * from chirps
+WHERE (user_id=sqlc.arg('user_id'))
+    AND ((sqlc.narg('cursor_created_at')::timestamp IS NULL)
+    OR ((created_at, id) > (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid)))
+    AND ((hidden_at IS NULL) OR (user_id=sqlc.narg('viewer_id')))
+ORDER BY created_at ASC, id ASC
+LIMIT sqlc.arg('page_size');
+
+-- name: GetChirpsByAuthorDesc :many
+Select * from chirps
+WHERE (user_id=sqlc.arg('user_id'))
+    AND ((sqlc.narg('cursor_created_at')::timestamp IS NULL)
+    OR ((created_at, id) < (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid)))
+    AND ((hidden_at IS NULL) OR (user_id=sqlc.narg('viewer_id')))
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg('page_size');
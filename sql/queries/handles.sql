@@ -0,0 +1,11 @@
+-- name: UserByHandle :one
+Select * from users WHERE handle=$1;
+
+-- name: GetUsersByHandles :many
+Select * from users WHERE handle = ANY(sqlc.arg('handles')::text[]);
+
+-- name: UpdateHandle :one
+UPDATE users
+SET handle=$1, updated_at=NOW()
+WHERE id=$2
+RETURNING *;
@@ -0,0 +1,54 @@
+-- name: UpsertHashtag :one
+INSERT INTO hashtags (id, tag, created_at)
+VALUES (
+    gen_random_uuid(),
+    $1,
+    NOW()
+)
+ON CONFLICT (tag) DO UPDATE SET tag=EXCLUDED.tag
+RETURNING *;
+
+-- name: AddChirpHashtag :exec
+INSERT INTO chirp_hashtags (chirp_id, hashtag_id, created_at)
+VALUES (
+    $1,
+    $2,
+    $3
+)
+ON CONFLICT (chirp_id, hashtag_id) DO NOTHING;
+
+-- name: ClearChirpHashtags :exec
+DELETE FROM chirp_hashtags
+WHERE chirp_id=$1;
+
+-- name: GetChirpsByHashtag :many
+Select chirps.* from chirps
+JOIN chirp_hashtags ON chirp_hashtags.chirp_id = chirps.id
+JOIN hashtags ON hashtags.id = chirp_hashtags.hashtag_id
+WHERE (hashtags.tag=sqlc.arg('tag'))
+    AND ((sqlc.narg('cursor_created_at')::timestamp IS NULL)
+    OR ((chirps.created_at, chirps.id) > (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid)))
+    AND ((chirps.hidden_at IS NULL) OR (chirps.user_id=sqlc.narg('viewer_id')))
+ORDER BY chirps.created_at ASC, chirps.id ASC
+LIMIT sqlc.arg('page_size');
+
+-- name: GetChirpsByHashtagDesc :many
+Select chirps.* from chirps
+JOIN chirp_hashtags ON chirp_hashtags.chirp_id = chirps.id
+JOIN hashtags ON hashtags.id = chirp_hashtags.hashtag_id
+WHERE (hashtags.tag=sqlc.arg('tag'))
+    AND ((sqlc.narg('cursor_created_at')::timestamp IS NULL)
+    OR ((chirps.created_at, chirps.id) < (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid)))
+    AND ((chirps.hidden_at IS NULL) OR (chirps.user_id=sqlc.narg('viewer_id')))
+ORDER BY chirps.created_at DESC, chirps.id DESC
+LIMIT sqlc.arg('page_size');
+
+-- name: GetTrendingHashtags :many
+SELECT hashtags.tag, COUNT(*) AS use_count FROM chirp_hashtags
+JOIN hashtags ON hashtags.id = chirp_hashtags.hashtag_id
+JOIN chirps ON chirps.id = chirp_hashtags.chirp_id
+WHERE (chirp_hashtags.created_at >= (NOW() - (sqlc.arg('window_seconds')::int * INTERVAL '1 second')))
+    AND (chirps.hidden_at IS NULL)
+GROUP BY hashtags.tag
+ORDER BY use_count DESC, hashtags.tag ASC
+LIMIT sqlc.arg('page_size');
@@ -0,0 +1,11 @@
+-- name: HideChirp :one
+UPDATE chirps
+SET hidden_at=NOW()
+WHERE id=$1
+RETURNING *;
+
+-- name: UnhideChirp :one
+UPDATE chirps
+SET hidden_at=NULL
+WHERE id=$1
+RETURNING *;
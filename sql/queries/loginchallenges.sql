@@ -0,0 +1,25 @@
+-- name: CreateLoginChallenge :one
+INSERT INTO login_challenges (id, token_hash, user_id, created_at, expires_at, attempts)
+VALUES (
+    gen_random_uuid(),
+    $1,
+    $2,
+    NOW(),
+    NOW() + INTERVAL '5 minutes',
+    0
+)
+RETURNING *;
+
+-- name: GetLoginChallenge :one
+SELECT * FROM login_challenges
+WHERE (token_hash=$1) AND (expires_at>NOW()) AND (used_at IS NULL) AND (attempts<sqlc.arg('max_attempts'));
+
+-- name: FailLoginChallenge :exec
+UPDATE login_challenges
+SET attempts=attempts+1
+WHERE id=$1;
+
+-- name: UseLoginChallenge :execrows
+UPDATE login_challenges
+SET used_at=NOW()
+WHERE (id=$1) AND (used_at IS NULL);
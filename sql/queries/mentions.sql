@@ -0,0 +1,32 @@
+-- name: AddChirpMention :exec
+INSERT INTO chirp_mentions (chirp_id, user_id, created_at)
+VALUES (
+    $1,
+    $2,
+    $3
+)
+ON CONFLICT (chirp_id, user_id) DO NOTHING;
+
+-- name: ClearChirpMentions :exec
+DELETE FROM chirp_mentions
+WHERE chirp_id=$1;
+
+-- name: GetMentions :many
+Select chirps.* from chirps
+JOIN chirp_mentions ON chirp_mentions.chirp_id = chirps.id
+WHERE (chirp_mentions.user_id=sqlc.arg('user_id'))
+    AND ((sqlc.narg('cursor_created_at')::timestamp IS NULL)
+    OR ((chirps.created_at, chirps.id) > (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid)))
+    AND (chirps.hidden_at IS NULL)
+ORDER BY chirps.created_at ASC, chirps.id ASC
+LIMIT sqlc.arg('page_size');
+
+-- name: GetMentionsDesc :many
+Select chirps.* from chirps
+JOIN chirp_mentions ON chirp_mentions.chirp_id = chirps.id
+WHERE (chirp_mentions.user_id=sqlc.arg('user_id'))
+    AND ((sqlc.narg('cursor_created_at')::timestamp IS NULL)
+    OR ((chirps.created_at, chirps.id) < (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid)))
+    AND (chirps.hidden_at IS NULL)
+ORDER BY chirps.created_at DESC, chirps.id DESC
+LIMIT sqlc.arg('page_size');
@@ -0,0 +1,82 @@
+-- name: CreateOAuthClient :one
+INSERT INTO oauth_clients (id, owner_id, name, secret_hash, redirect_uris, scopes, created_at)
+VALUES (
+    gen_random_uuid(),
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    NOW()
+)
+RETURNING *;
+
+-- name: GetOAuthClient :one
+SELECT * FROM oauth_clients
+WHERE (id=$1) AND (revoked_at IS NULL);
+
+-- name: GetOAuthClientsByOwner :many
+SELECT * FROM oauth_clients
+WHERE (owner_id=$1) AND (revoked_at IS NULL)
+ORDER BY created_at DESC;
+
+-- name: RevokeOAuthClient :execrows
+UPDATE oauth_clients
+SET revoked_at=NOW()
+WHERE (id=$1) AND (owner_id=$2) AND (revoked_at IS NULL);
+
+-- name: RevokeClientRefreshTokens :execrows
+UPDATE refresh_tokens
+SET updated_at = NOW(), revoked_at = NOW()
+WHERE (client_id=$1) AND (revoked_at IS NULL);
+
+-- name: RevokeClientRefreshTokensForUser :execrows
+UPDATE refresh_tokens
+SET updated_at = NOW(), revoked_at = NOW()
+WHERE (client_id=$1) AND (user_id=$2) AND (revoked_at IS NULL);
+
+-- name: UpsertOAuthConsent :one
+INSERT INTO oauth_consents (user_id, client_id, scopes, created_at, updated_at)
+VALUES ($1, $2, $3, NOW(), NOW())
+ON CONFLICT (user_id, client_id) DO UPDATE
+SET scopes=ARRAY(SELECT DISTINCT unnest(oauth_consents.scopes || EXCLUDED.scopes) ORDER BY 1), updated_at=NOW()
+RETURNING *;
+
+-- name: GetOAuthConsent :one
+SELECT * FROM oauth_consents
+WHERE (user_id=$1) AND (client_id=$2);
+
+-- name: GetOAuthConsents :many
+SELECT c.client_id, o.name, c.scopes, c.created_at, c.updated_at
+FROM oauth_consents c
+JOIN oauth_clients o ON o.id=c.client_id
+WHERE (c.user_id=$1) AND (o.revoked_at IS NULL)
+ORDER BY c.updated_at DESC;
+
+-- name: DeleteOAuthConsent :execrows
+DELETE FROM oauth_consents
+WHERE (user_id=$1) AND (client_id=$2);
+
+-- name: CreateAuthorizationCode :one
+INSERT INTO oauth_authorization_codes (id, code_hash, client_id, user_id, redirect_uri, scopes, code_challenge, created_at, expires_at)
+VALUES (
+    gen_random_uuid(),
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6,
+    NOW(),
+    NOW() + INTERVAL '10 minutes'
+)
+RETURNING *;
+
+-- name: GetAuthorizationCode :one
+SELECT * FROM oauth_authorization_codes
+WHERE code_hash=$1;
+
+-- name: UseAuthorizationCode :execrows
+UPDATE oauth_authorization_codes
+SET used_at=NOW()
+WHERE (id=$1) AND (used_at IS NULL) AND (expires_at>NOW());
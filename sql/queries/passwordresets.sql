@@ -0,0 +1,19 @@
+-- name: CreatePasswordResetToken :one
+INSERT INTO password_reset_tokens (id, token_hash, user_id, created_at, expires_at)
+VALUES (
+    gen_random_uuid(),
+    $1,
+    $2,
+    NOW(),
+    NOW() + INTERVAL '1 hour'
+)
+RETURNING *;
+
+-- name: GetPasswordResetToken :one
+SELECT * FROM password_reset_tokens
+WHERE (token_hash=$1) AND (expires_at>NOW()) AND (used_at IS NULL);
+
+-- name: UsePasswordResetTokens :execrows
+UPDATE password_reset_tokens
+SET used_at=NOW()
+WHERE (user_id=$1) AND (used_at IS NULL);
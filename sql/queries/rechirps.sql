@@ -0,0 +1,3 @@
+-- name: GetRechirpByUser :one
+Select * from chirps
+WHERE user_id=$1 AND original_id=$2 AND kind='rechirp';
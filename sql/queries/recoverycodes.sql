@@ -0,0 +1,19 @@
+-- name: CreateRecoveryCode :exec
+INSERT INTO recovery_codes (id, user_id, code_hash, created_at)
+VALUES (
+    gen_random_uuid(),
+    $1,
+    $2,
+    NOW()
+);
+
+-- name: DeleteRecoveryCodes :exec
+DELETE FROM recovery_codes WHERE user_id=$1;
+
+-- name: UseRecoveryCode :execrows
+UPDATE recovery_codes
+SET used_at=NOW()
+WHERE (user_id=$1) AND (code_hash=$2) AND (used_at IS NULL);
+
+-- name: CountRecoveryCodes :one
+SELECT COUNT(*) FROM recovery_codes WHERE (user_id=$1) AND (used_at IS NULL);
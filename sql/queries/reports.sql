@@ -0,0 +1,27 @@
+-- name: CreateReport :one
+INSERT INTO chirp_reports (id, chirp_id, reporter_id, reason, created_at)
+VALUES (
+    gen_random_uuid(),
+    $1,
+    $2,
+    $3,
+    NOW()
+)
+RETURNING *;
+
+-- name: GetOpenReportByReporter :one
+Select * from chirp_reports
+WHERE chirp_id=$1 AND reporter_id=$2 AND resolved_at IS NULL;
+
+-- name: GetOpenReports :many
+Select * from chirp_reports
+WHERE (resolved_at IS NULL)
+    AND ((sqlc.narg('cursor_created_at')::timestamp IS NULL)
+    OR ((created_at, id) > (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid)))
+ORDER BY created_at ASC, id ASC
+LIMIT sqlc.arg('page_size');
+
+-- name: ResolveReports :execrows
+UPDATE chirp_reports
+SET resolved_at=NOW(), resolution=$1
+WHERE chirp_id=$2 AND resolved_at IS NULL;
@@ -1,5 +1,5 @@
 -- name: RevokeRefreshToken :one
 UPDATE refresh_tokens
 SET updated_at = NOW(), revoked_at = NOW()
-WHERE token=$1
+WHERE id=$1
 RETURNING *;
\ No newline at end of file
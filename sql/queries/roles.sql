@@ -0,0 +1,11 @@
+-- name: UpdateUserRole :one
+UPDATE users
+SET role=$1, updated_at=NOW()
+WHERE id=$2
+RETURNING *;
+
+-- name: SetRoleByEmail :execrows
+UPDATE users
+SET role=$1, updated_at=NOW()
+WHERE (email=$2) AND (email_verified_at IS NOT NULL)
+    AND NOT EXISTS (SELECT 1 FROM users WHERE role=$1);
@@ -0,0 +1,19 @@
+-- name: RevokeActiveRefreshToken :one
+UPDATE refresh_tokens
+SET updated_at = NOW(), revoked_at = NOW(), rotated_at = NOW()
+WHERE (id=$1) AND (revoked_at IS NULL)
+RETURNING *;
+
+-- name: RevokeRefreshTokenFamily :execrows
+UPDATE refresh_tokens
+SET updated_at = NOW(), revoked_at = NOW()
+WHERE (family_id=$1) AND (revoked_at IS NULL);
+
+-- name: UseRefreshTokenGrace :execrows
+UPDATE refresh_tokens t
+SET updated_at = NOW(), grace_used_at = NOW()
+WHERE (t.id=$1) AND (t.grace_used_at IS NULL) AND (t.rotated_at>NOW() - INTERVAL '10 seconds')
+    AND EXISTS (
+        SELECT 1 FROM refresh_tokens f
+        WHERE (f.family_id=t.family_id) AND (f.revoked_at IS NULL) AND (f.expires_at>NOW())
+    );
@@ -0,0 +1,10 @@
+-- name: SearchChirps :many
+SELECT chirps.*, ts_rank(to_tsvector('english', chirps.body), to_tsquery('english', sqlc.arg('query'))) AS rank
+FROM chirps
+WHERE (to_tsvector('english', chirps.body) @@ to_tsquery('english', sqlc.arg('query')))
+    AND ((sqlc.narg('author_id')::uuid IS NULL) OR (chirps.user_id=sqlc.narg('author_id')::uuid))
+    AND ((sqlc.narg('since')::timestamp IS NULL) OR (chirps.created_at >= sqlc.narg('since')::timestamp))
+    AND ((sqlc.narg('until')::timestamp IS NULL) OR (chirps.created_at < sqlc.narg('until')::timestamp))
+    AND ((chirps.hidden_at IS NULL) OR (chirps.user_id=sqlc.narg('viewer_id')))
+ORDER BY rank DESC, chirps.created_at DESC, chirps.id DESC
+LIMIT sqlc.arg('page_size') OFFSET sqlc.arg('page_offset');
@@ -0,0 +1,20 @@
+-- name: GetSessions :many
+SELECT s.family_id, s.user_agent, s.ip, s.last_used_at, s.expires_at, s.started_at
+FROM (
+    SELECT DISTINCT ON (t.family_id) t.family_id, t.user_agent, t.ip, t.last_used_at, t.expires_at,
+        (SELECT MIN(f.created_at) FROM refresh_tokens f WHERE f.family_id=t.family_id)::timestamp AS started_at
+    FROM refresh_tokens t
+    WHERE (t.user_id=$1) AND (t.client_id IS NULL) AND (t.revoked_at IS NULL) AND (t.expires_at>NOW())
+    ORDER BY t.family_id, t.last_used_at DESC
+) s
+ORDER BY s.last_used_at DESC;
+
+-- name: RevokeSession :execrows
+UPDATE refresh_tokens
+SET updated_at = NOW(), revoked_at = NOW()
+WHERE (user_id=$1) AND (family_id=$2) AND (client_id IS NULL) AND (revoked_at IS NULL);
+
+-- name: RevokeAllSessions :execrows
+UPDATE refresh_tokens
+SET updated_at = NOW(), revoked_at = NOW()
+WHERE (user_id=$1) AND (revoked_at IS NULL);
@@ -0,0 +1,19 @@
+-- name: GetTimeline :many
+Select chirps.* from chirps
+JOIN follows ON follows.followee_id = chirps.user_id
+WHERE (follows.follower_id=sqlc.arg('follower_id'))
+    AND ((sqlc.narg('cursor_created_at')::timestamp IS NULL)
+    OR ((chirps.created_at, chirps.id) > (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid)))
+    AND (chirps.hidden_at IS NULL)
+ORDER BY chirps.created_at ASC, chirps.id ASC
+LIMIT sqlc.arg('page_size');
+
+-- name: GetTimelineDesc :many
+Select chirps.* from chirps
+JOIN follows ON follows.followee_id = chirps.user_id
+WHERE (follows.follower_id=sqlc.arg('follower_id'))
+    AND ((sqlc.narg('cursor_created_at')::timestamp IS NULL)
+    OR ((chirps.created_at, chirps.id) < (sqlc.narg('cursor_created_at')::timestamp, sqlc.narg('cursor_id')::uuid)))
+    AND (chirps.hidden_at IS NULL)
+ORDER BY chirps.created_at DESC, chirps.id DESC
+LIMIT sqlc.arg('page_size');
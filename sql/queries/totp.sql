@@ -0,0 +1,29 @@
+-- name: StartTOTPEnrollment :one
+INSERT INTO user_totp (user_id, secret, created_at, enabled_at, last_counter)
+VALUES (
+    $1,
+    $2,
+    NOW(),
+    NULL,
+    0
+)
+ON CONFLICT (user_id) DO UPDATE
+SET secret=EXCLUDED.secret, created_at=NOW(), last_counter=0
+WHERE user_totp.enabled_at IS NULL
+RETURNING *;
+
+-- name: GetTOTP :one
+SELECT * FROM user_totp WHERE user_id=$1;
+
+-- name: EnableTOTP :execrows
+UPDATE user_totp
+SET enabled_at=NOW(), last_counter=$2
+WHERE (user_id=$1) AND (enabled_at IS NULL) AND (secret=$3);
+
+-- name: UseTOTPCounter :execrows
+UPDATE user_totp
+SET last_counter=$2
+WHERE (user_id=$1) AND (last_counter<$2);
+
+-- name: DeleteTOTP :exec
+DELETE FROM user_totp WHERE user_id=$1;
@@ -0,0 +1,5 @@
+-- name: UpdateChirp :one
+UPDATE chirps
+SET body=$1, updated_at=NOW()
+WHERE id=$2
+RETURNING *;
@@ -0,0 +1,2 @@
+-- name: UserByID :one
+Select * from users WHERE id=$1;
@@ -0,0 +1,12 @@
+-- +goose Up
+CREATE TABLE chirp_revisions(
+    id UUID DEFAULT gen_random_uuid() PRIMARY KEY,
+    chirp_id UUID REFERENCES chirps(id) ON DELETE CASCADE NOT NULL,
+    body TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    replaced_at TIMESTAMP NOT NULL
+);
+CREATE INDEX chirp_revisions_chirp_id_idx ON chirp_revisions(chirp_id, replaced_at);
+
+-- +goose Down
+DROP TABLE chirp_revisions;
@@ -0,0 +1,9 @@
+-- +goose Up
+ALTER TABLE chirps
+ADD COLUMN parent_id UUID REFERENCES chirps(id) ON DELETE SET NULL;
+CREATE INDEX chirps_parent_id_created_at_id_idx ON chirps(parent_id, created_at, id);
+
+-- +goose Down
+DROP INDEX chirps_parent_id_created_at_id_idx;
+ALTER TABLE chirps
+DROP COLUMN parent_id;
@@ -0,0 +1,11 @@
+-- +goose Up
+ALTER TABLE chirps
+ADD COLUMN kind TEXT NOT NULL DEFAULT 'chirp' CHECK (kind IN ('chirp', 'rechirp', 'quote')),
+ADD COLUMN original_id UUID REFERENCES chirps(id) ON DELETE SET NULL;
+CREATE UNIQUE INDEX chirps_rechirp_once_idx ON chirps(user_id, original_id) WHERE kind = 'rechirp';
+
+-- +goose Down
+DROP INDEX chirps_rechirp_once_idx;
+ALTER TABLE chirps
+DROP COLUMN original_id,
+DROP COLUMN kind;
@@ -0,0 +1,30 @@
+-- +goose Up
+CREATE TABLE hashtags(
+    id UUID DEFAULT gen_random_uuid() PRIMARY KEY,
+    tag TEXT NOT NULL UNIQUE,
+    created_at TIMESTAMP NOT NULL
+);
+CREATE TABLE chirp_hashtags(
+    chirp_id UUID REFERENCES chirps(id) ON DELETE CASCADE NOT NULL,
+    hashtag_id UUID REFERENCES hashtags(id) ON DELETE CASCADE NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (chirp_id, hashtag_id)
+);
+CREATE INDEX chirp_hashtags_hashtag_id_idx ON chirp_hashtags(hashtag_id, created_at);
+CREATE INDEX chirp_hashtags_created_at_idx ON chirp_hashtags(created_at);
+
+-- Backfill tags for chirps written before hashtags were tracked.
+INSERT INTO hashtags (id, tag, created_at)
+SELECT gen_random_uuid(), tag, NOW() FROM (
+    SELECT DISTINCT lower(m[2]) AS tag
+    FROM chirps CROSS JOIN LATERAL regexp_matches(chirps.body, '(^|[^\w#])#(\w+)', 'g') AS m
+    WHERE (m[2] ~ '[[:alpha:]]') AND (length(m[2]) <= 50)
+) AS tags;
+INSERT INTO chirp_hashtags (chirp_id, hashtag_id, created_at)
+SELECT DISTINCT chirps.id, hashtags.id, chirps.created_at
+FROM chirps CROSS JOIN LATERAL regexp_matches(chirps.body, '(^|[^\w#])#(\w+)', 'g') AS m
+JOIN hashtags ON hashtags.tag = lower(m[2]);
+
+-- +goose Down
+DROP TABLE chirp_hashtags;
+DROP TABLE hashtags;
@@ -0,0 +1,15 @@
+-- +goose Up
+ALTER TABLE users
+ADD COLUMN handle TEXT UNIQUE;
+CREATE TABLE chirp_mentions(
+    chirp_id UUID REFERENCES chirps(id) ON DELETE CASCADE NOT NULL,
+    user_id UUID REFERENCES users(id) ON DELETE CASCADE NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (chirp_id, user_id)
+);
+CREATE INDEX chirp_mentions_user_id_idx ON chirp_mentions(user_id, created_at);
+
+-- +goose Down
+DROP TABLE chirp_mentions;
+ALTER TABLE users
+DROP COLUMN handle;
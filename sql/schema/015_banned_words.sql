@@ -0,0 +1,8 @@
+-- +goose Up
+CREATE TABLE banned_words(
+    word TEXT PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL
+);
+
+-- +goose Down
+DROP TABLE banned_words;
@@ -0,0 +1,19 @@
+-- +goose Up
+ALTER TABLE chirps
+ADD COLUMN hidden_at TIMESTAMP;
+CREATE TABLE chirp_reports(
+    id UUID DEFAULT gen_random_uuid() PRIMARY KEY,
+    chirp_id UUID REFERENCES chirps(id) ON DELETE CASCADE NOT NULL,
+    reporter_id UUID REFERENCES users(id) ON DELETE CASCADE NOT NULL,
+    reason TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    resolved_at TIMESTAMP,
+    resolution TEXT CHECK (resolution IN ('dismissed', 'hidden'))
+);
+CREATE UNIQUE INDEX chirp_reports_open_once_idx ON chirp_reports(chirp_id, reporter_id) WHERE resolved_at IS NULL;
+CREATE INDEX chirp_reports_open_idx ON chirp_reports(created_at, id) WHERE resolved_at IS NULL;
+
+-- +goose Down
+DROP TABLE chirp_reports;
+ALTER TABLE chirps
+DROP COLUMN hidden_at;
@@ -0,0 +1,13 @@
+-- +goose Up
+ALTER TABLE refresh_tokens
+ADD COLUMN family_id UUID;
+-- Tokens issued before rotation each start a family of their own.
+UPDATE refresh_tokens SET family_id=gen_random_uuid();
+ALTER TABLE refresh_tokens
+ALTER COLUMN family_id SET NOT NULL;
+CREATE INDEX refresh_tokens_family_idx ON refresh_tokens(family_id);
+
+-- +goose Down
+DROP INDEX refresh_tokens_family_idx;
+ALTER TABLE refresh_tokens
+DROP COLUMN family_id;
@@ -0,0 +1,16 @@
+-- +goose Up
+ALTER TABLE refresh_tokens
+ADD COLUMN user_agent TEXT NOT NULL DEFAULT '',
+ADD COLUMN ip TEXT NOT NULL DEFAULT '',
+ADD COLUMN last_used_at TIMESTAMP;
+UPDATE refresh_tokens SET last_used_at=updated_at;
+ALTER TABLE refresh_tokens
+ALTER COLUMN last_used_at SET NOT NULL;
+CREATE INDEX refresh_tokens_user_active_idx ON refresh_tokens(user_id) WHERE revoked_at IS NULL;
+
+-- +goose Down
+DROP INDEX refresh_tokens_user_active_idx;
+ALTER TABLE refresh_tokens
+DROP COLUMN user_agent,
+DROP COLUMN ip,
+DROP COLUMN last_used_at;
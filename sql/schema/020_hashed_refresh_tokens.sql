@@ -0,0 +1,22 @@
+-- +goose Up
+ALTER TABLE refresh_tokens
+ADD COLUMN id UUID NOT NULL DEFAULT gen_random_uuid(),
+ADD COLUMN token_prefix TEXT,
+ADD COLUMN token_hash BYTEA;
+UPDATE refresh_tokens SET token_prefix=LEFT(token, 16), token_hash=sha256(convert_to(token, 'UTF8'));
+ALTER TABLE refresh_tokens
+ALTER COLUMN token_prefix SET NOT NULL,
+ALTER COLUMN token_hash SET NOT NULL,
+DROP COLUMN token,
+ADD PRIMARY KEY (id);
+CREATE INDEX refresh_tokens_prefix_idx ON refresh_tokens(token_prefix);
+
+-- +goose Down
+-- Plain tokens cannot be recovered from their digests, everyone logs in again.
+DELETE FROM refresh_tokens;
+DROP INDEX refresh_tokens_prefix_idx;
+ALTER TABLE refresh_tokens
+DROP COLUMN id,
+DROP COLUMN token_prefix,
+DROP COLUMN token_hash,
+ADD COLUMN token TEXT PRIMARY KEY;
@@ -0,0 +1,30 @@
+-- +goose Up
+CREATE TABLE user_totp(
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    secret TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    enabled_at TIMESTAMP,
+    last_counter BIGINT NOT NULL DEFAULT 0
+);
+CREATE TABLE recovery_codes(
+    id UUID DEFAULT gen_random_uuid() PRIMARY KEY,
+    user_id UUID REFERENCES users(id) ON DELETE CASCADE NOT NULL,
+    code_hash BYTEA NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP
+);
+CREATE INDEX recovery_codes_user_idx ON recovery_codes(user_id);
+CREATE TABLE login_challenges(
+    id UUID DEFAULT gen_random_uuid() PRIMARY KEY,
+    token_hash BYTEA NOT NULL UNIQUE,
+    user_id UUID REFERENCES users(id) ON DELETE CASCADE NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    used_at TIMESTAMP
+);
+
+-- +goose Down
+DROP TABLE login_challenges;
+DROP TABLE recovery_codes;
+DROP TABLE user_totp;
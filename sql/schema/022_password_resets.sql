@@ -0,0 +1,13 @@
+-- +goose Up
+CREATE TABLE password_reset_tokens(
+    id UUID DEFAULT gen_random_uuid() PRIMARY KEY,
+    token_hash BYTEA NOT NULL UNIQUE,
+    user_id UUID REFERENCES users(id) ON DELETE CASCADE NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP
+);
+CREATE INDEX password_reset_tokens_user_idx ON password_reset_tokens(user_id);
+
+-- +goose Down
+DROP TABLE password_reset_tokens;
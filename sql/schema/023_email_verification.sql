@@ -0,0 +1,21 @@
+-- +goose Up
+ALTER TABLE users
+ADD COLUMN email_verified_at TIMESTAMP;
+-- Accounts created before verification existed are treated as verified.
+UPDATE users SET email_verified_at=created_at;
+
+CREATE TABLE email_verification_tokens(
+    id UUID DEFAULT gen_random_uuid() PRIMARY KEY,
+    token_hash BYTEA NOT NULL UNIQUE,
+    user_id UUID REFERENCES users(id) ON DELETE CASCADE NOT NULL,
+    email TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP
+);
+CREATE INDEX email_verification_tokens_user_idx ON email_verification_tokens(user_id);
+
+-- +goose Down
+DROP TABLE email_verification_tokens;
+ALTER TABLE users
+DROP COLUMN email_verified_at;
@@ -0,0 +1,49 @@
+-- +goose Up
+CREATE TABLE oauth_clients(
+    id UUID DEFAULT gen_random_uuid() PRIMARY KEY,
+    owner_id UUID REFERENCES users(id) ON DELETE CASCADE NOT NULL,
+    name TEXT NOT NULL,
+    -- NULL for public clients, like mobile apps, that can not keep a secret.
+    secret_hash BYTEA,
+    redirect_uris TEXT[] NOT NULL,
+    scopes TEXT[] NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    revoked_at TIMESTAMP
+);
+CREATE INDEX oauth_clients_owner_idx ON oauth_clients(owner_id);
+
+CREATE TABLE oauth_consents(
+    user_id UUID REFERENCES users(id) ON DELETE CASCADE NOT NULL,
+    client_id UUID REFERENCES oauth_clients(id) ON DELETE CASCADE NOT NULL,
+    scopes TEXT[] NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (user_id, client_id)
+);
+
+CREATE TABLE oauth_authorization_codes(
+    id UUID DEFAULT gen_random_uuid() PRIMARY KEY,
+    code_hash BYTEA NOT NULL UNIQUE,
+    client_id UUID REFERENCES oauth_clients(id) ON DELETE CASCADE NOT NULL,
+    user_id UUID REFERENCES users(id) ON DELETE CASCADE NOT NULL,
+    redirect_uri TEXT NOT NULL,
+    scopes TEXT[] NOT NULL,
+    code_challenge TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP
+);
+
+-- Refresh tokens of OAuth clients live next to the ones of logins. client_id
+-- is NULL for logins, which are not limited by scopes.
+ALTER TABLE refresh_tokens
+ADD COLUMN client_id UUID REFERENCES oauth_clients(id) ON DELETE CASCADE,
+ADD COLUMN scopes TEXT[] NOT NULL DEFAULT '{}';
+
+-- +goose Down
+ALTER TABLE refresh_tokens
+DROP COLUMN client_id,
+DROP COLUMN scopes;
+DROP TABLE oauth_authorization_codes;
+DROP TABLE oauth_consents;
+DROP TABLE oauth_clients;
@@ -0,0 +1,13 @@
+-- +goose Up
+-- Remembers that the default word list was loaded once, so an admin who
+-- removes every banned word does not get the defaults back on restart.
+CREATE TABLE banned_words_seeded(
+    id BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (id),
+    seeded_at TIMESTAMP NOT NULL
+);
+-- Databases that already have words were seeded before this table existed.
+INSERT INTO banned_words_seeded (seeded_at)
+SELECT NOW() WHERE EXISTS (SELECT 1 FROM banned_words);
+
+-- +goose Down
+DROP TABLE banned_words_seeded;
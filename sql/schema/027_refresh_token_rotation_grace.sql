@@ -0,0 +1,10 @@
+-- +goose Up
+-- Set when a refresh token is revoked because it was traded for a new one,
+-- as opposed to a logout, so a second refresh racing the first can be told
+-- apart from a stolen token.
+ALTER TABLE refresh_tokens
+ADD COLUMN rotated_at TIMESTAMP;
+
+-- +goose Down
+ALTER TABLE refresh_tokens
+DROP COLUMN rotated_at;
@@ -0,0 +1,9 @@
+-- +goose Up
+-- Set when a rotated refresh token was traded once more inside the grace
+-- window, so the window can only be used once per token.
+ALTER TABLE refresh_tokens
+ADD COLUMN grace_used_at TIMESTAMP;
+
+-- +goose Down
+ALTER TABLE refresh_tokens
+DROP COLUMN grace_used_at;